@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// backgroundJobs keeps track of the goroutines started outside of a request,
+// so that shutdown can wait for them and name the ones it gave up on.
+type backgroundJobs struct {
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	nextID  int
+	running map[int]backgroundJob
+}
+
+type backgroundJob struct {
+	name    string
+	started time.Time
+}
+
+// background runs fn in its own goroutine, recovering from panics.
+func (app *application) background(name string, fn func()) {
+	jobs := &app.jobs
+	jobs.mu.Lock()
+	if jobs.running == nil {
+		jobs.running = make(map[int]backgroundJob)
+	}
+	id := jobs.nextID
+	jobs.nextID++
+	jobs.running[id] = backgroundJob{name: name, started: time.Now()}
+	jobs.mu.Unlock()
+
+	jobs.wg.Add(1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				zap.S().Errorw("background job panicked", "job", name, "error", fmt.Sprintf("%v", err))
+			}
+			jobs.mu.Lock()
+			delete(jobs.running, id)
+			jobs.mu.Unlock()
+			jobs.wg.Done()
+		}()
+		fn()
+	}()
+}
+
+// waitBackground waits up to timeout for the background jobs to finish and
+// describes the ones still running when it gives up.
+func (app *application) waitBackground(timeout time.Duration) []string {
+	done := make(chan struct{})
+	go func() {
+		app.jobs.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	app.jobs.mu.Lock()
+	defer app.jobs.mu.Unlock()
+	abandoned := make([]string, 0, len(app.jobs.running))
+	for _, job := range app.jobs.running {
+		abandoned = append(abandoned, fmt.Sprintf("%s (running for %s)", job.name, time.Since(job.started).Round(time.Second)))
+	}
+	sort.Strings(abandoned)
+	return abandoned
+}
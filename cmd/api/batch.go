@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+// batchInput is the body of POST /v1/batch. Paths may be unversioned, as on
+// any other request.
+type batchInput struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations" validate:"required,minItems=1,maxItems=20"`
+}
+
+type batchOperation struct {
+	Method string          `json:"method" validate:"required,enum=GET|POST|PUT|PATCH|DELETE"`
+	Path   string          `json:"path" validate:"required,pattern=^/"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchResult is the response to one operation. Body holds the JSON response
+// as is, and other representations as a string.
+type batchResult struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// batchHeaders are the response headers of an operation reported in its
+// result.
+var batchHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+var errBatchFailed = errors.New("batch operation failed")
+
+// batch is shared by the operations of a batch request. The caller is
+// authenticated and has its quota charged and permissions loaded once for
+// the whole batch, so that the operations of an atomic batch make no query
+// outside its transaction. Rate limits are still applied per operation, in
+// the limiter's own store.
+type batch struct {
+	permissions data.Permissions
+	// models is bound to the transaction of an atomic batch, nil otherwise.
+	models *data.Models
+}
+
+func batchFromContext(ctx context.Context) *batch {
+	b, _ := ctx.Value(batchKey).(*batch)
+	return b
+}
+
+// batchHandler runs the operations in order through the same router and
+// middleware as standalone requests, as the user of the batch request. Every
+// operation counts against that user's daily quota, charged up front. In
+// atomic mode only movie operations are accepted; they share one transaction,
+// and the first failing operation rolls it back and skips the rest with 424
+// Failed Dependency.
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input batchInput
+	if !app.bind(w, r, &input) {
+		return
+	}
+	errs := make(map[string]string)
+	for i, op := range input.Operations {
+		path := strings.SplitN(op.Path, "?", 2)[0]
+		resource := path
+		if version := pathVersion(path); version != "" {
+			resource = strings.TrimPrefix(path, "/"+version)
+		}
+		switch {
+		case resource == "/batch":
+			errs[fmt.Sprintf("operations[%d].path", i)] = "must not be a batch"
+		case input.Atomic && resource != "/movies" && !strings.HasPrefix(resource, "/movies/"):
+			errs[fmt.Sprintf("operations[%d].path", i)] = "must be a movie route in an atomic batch"
+		}
+	}
+	if len(errs) > 0 {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+
+	user, ok := r.Context().Value(contextUser("user")).(*data.User)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("invalid context value"))
+		return
+	}
+	b := &batch{}
+	if !user.IsAnonymous() {
+		// The batch request itself was counted by enforceQuota.
+		if n := len(input.Operations) - 1; n > 0 {
+			_, err := app.models.Usage.Increment(r.Context(), user.ID, user.Quota, n)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrQuotaExceeded):
+					app.dailyQuotaExceededResponse(w, r, user.Quota)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+		permissions, err := app.models.Permission.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		b.permissions = permissions
+	}
+
+	results := make([]batchResult, len(input.Operations))
+	if !input.Atomic {
+		ctx := context.WithValue(r.Context(), batchKey, b)
+		for i, op := range input.Operations {
+			results[i] = app.dispatchBatchOperation(ctx, r, op)
+		}
+		err := app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err := app.models.Transaction(r.Context(), func(tx data.Models) error {
+		b.models = &tx
+		ctx := context.WithValue(r.Context(), batchKey, b)
+		for i, op := range input.Operations {
+			results[i] = app.dispatchBatchOperation(ctx, r, op)
+			if results[i].Status >= http.StatusBadRequest {
+				for j := i + 1; j < len(results); j++ {
+					results[j] = batchResult{Status: http.StatusFailedDependency}
+				}
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"committed": err == nil, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// dispatchBatchOperation serves op as a request carrying the headers of the
+// batch request r, apart from those describing its body and encoding.
+func (app *application) dispatchBatchOperation(ctx context.Context, r *http.Request, op batchOperation) batchResult {
+	var body []byte
+	if len(op.Body) > 0 && string(op.Body) != "null" {
+		body = op.Body
+	}
+	req, err := http.NewRequestWithContext(ctx, op.Method, op.Path, bytes.NewReader(body))
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest}
+	}
+	req.Header = r.Header.Clone()
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Accept-Encoding", "Idempotency-Key"} {
+		req.Header.Del(name)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", mediaTypeJSON)
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.TLS = r.TLS
+
+	rec := &batchRecorder{header: make(http.Header)}
+	app.dispatch.ServeHTTP(rec, req)
+
+	result := batchResult{Status: rec.status, Headers: make(map[string]string)}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	for _, name := range batchHeaders {
+		if value := rec.header.Get(name); value != "" {
+			result.Headers[name] = value
+		}
+	}
+	switch {
+	case rec.body.Len() == 0:
+	case json.Valid(rec.body.Bytes()):
+		result.Body = rec.body.Bytes()
+	default:
+		result.Body, _ = json.Marshal(rec.body.String())
+	}
+	return result
+}
+
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *batchRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *batchRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+// movies returns the movie model bound to the transaction of an atomic batch
+// when r is one of its operations.
+func (app *application) movies(r *http.Request) *data.MovieModel {
+	if b := batchFromContext(r.Context()); b != nil && b.models != nil {
+		return &b.models.Movies
+	}
+	return &app.models.Movies
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/ratelimit"
+)
+
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+	Invalid   []struct {
+		Name string `json:"name"`
+	} `json:"invalid-params"`
+}
+
+func serveBatch(t *testing.T, app *application, body string) (int, batchResponse) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", mediaTypeJSON)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	var res batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return w.Code, res
+}
+
+var batchUser = &data.User{ID: 9, Activated: true, Quota: data.QuotaTier{Name: "free", RequestsPerMinute: 60, DailyLimit: 100}}
+
+// expectBatch expects the queries made once per batch of n operations before
+// any of them runs.
+func expectBatch(mock sqlmock.Sqlmock, n int) {
+	expectAuthentication(mock, batchUser)
+	expectUsage(mock, batchUser, 1)
+	expectUsage(mock, batchUser, n-1)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT p.code")).WithArgs(batchUser.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("movies:read").AddRow("movies:write"))
+}
+
+// The test application has a single database connection, so an atomic batch
+// making any query outside its transaction would time out.
+func TestAtomicBatchRollsBackAndSkipsTheRest(t *testing.T) {
+	app, mock := newTestApplication(t)
+	expectBatch(mock, 3)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO movies")).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "id", "version"}).AddRow(time.Now(), 1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(99)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}))
+	mock.ExpectRollback()
+
+	status, res := serveBatch(t, app, `{"atomic":true,"operations":[
+		{"method":"POST","path":"/v1/movies","body":{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}},
+		{"method":"GET","path":"/v1/movies/99"},
+		{"method":"DELETE","path":"/v1/movies/1"}
+	]}`)
+
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	if res.Committed {
+		t.Error("the batch was committed")
+	}
+	want := []int{http.StatusCreated, http.StatusNotFound, http.StatusFailedDependency}
+	if len(res.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(res.Results), len(want))
+	}
+	for i, status := range want {
+		if res.Results[i].Status != status {
+			t.Errorf("operation %d: got status %d, want %d", i, res.Results[i].Status, status)
+		}
+	}
+}
+
+func TestAtomicBatchCommits(t *testing.T) {
+	app, mock := newTestApplication(t)
+	expectBatch(mock, 2)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO movies")).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "id", "version"}).AddRow(time.Now(), 1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}).
+			AddRow(2, "Frozen", 2013, 102, 1, time.Now(), "{animation}"))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM movies")).WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, res := serveBatch(t, app, `{"atomic":true,"operations":[
+		{"method":"POST","path":"/v1/movies","body":{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}},
+		{"method":"DELETE","path":"/v1/movies/2"}
+	]}`)
+
+	if !res.Committed {
+		t.Error("the batch was not committed")
+	}
+	for i, result := range res.Results {
+		if result.Status >= http.StatusBadRequest {
+			t.Errorf("operation %d failed with %d", i, result.Status)
+		}
+	}
+}
+
+func TestBatchRejectsNestedBatches(t *testing.T) {
+	app, mock := newTestApplication(t)
+	expectAuthentication(mock, batchUser)
+	expectUsage(mock, batchUser, 1)
+
+	status, res := serveBatch(t, app, `{"operations":[
+		{"method":"GET","path":"/v1/movies/1"},
+		{"method":"POST","path":"/batch","body":{"operations":[]}},
+		{"method":"POST","path":"/v2/batch"}
+	]}`)
+
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+	var fields []string
+	for _, p := range res.Invalid {
+		fields = append(fields, p.Name)
+	}
+	if got, want := strings.Join(fields, " "), "operations[1].path operations[2].path"; got != want {
+		t.Errorf("got errors for %s, want %s", got, want)
+	}
+}
+
+func TestBatchOperationsAreInstrumented(t *testing.T) {
+	app, mock := newTestApplication(t)
+	expectBatch(mock, 2)
+	for _, id := range []int64{41, 42} {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}))
+	}
+
+	serveBatch(t, app, `{"operations":[{"method":"GET","path":"/v2/movies/41"},{"method":"GET","path":"/v2/movies/42"}]}`)
+
+	var b bytes.Buffer
+	app.metrics.registry.WritePrometheus(&b)
+	for _, want := range []string{
+		`http_requests_total{route="/v1/batch",method="POST",status="200"}`,
+		`http_requests_total{route="/v2/movies/{id:[0-9]+}",method="GET",status="404"} 2`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestBatchOperationsAreRateLimitedByTheirRoute(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.limiter = ratelimit.NewMemory()
+	cfg := app.config()
+	cfg.Limiter.Enabled = true
+	cfg.Limiter.Policies = ratelimit.Policies{
+		"batch":  {Name: "batch", Limit: 10, Window: time.Minute, KeyBy: ratelimit.KeyByIP},
+		"tokens": {Name: "tokens", Limit: 2, Window: time.Minute, KeyBy: ratelimit.KeyByIP},
+	}
+
+	body := `{"operations":[
+		{"method":"POST","path":"/v1/tokens/authentication","body":{}},
+		{"method":"POST","path":"/v1/tokens/authentication","body":{}},
+		{"method":"POST","path":"/v1/tokens/authentication","body":{}}
+	]}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", mediaTypeJSON)
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	var res batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+
+	want := []int{http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, http.StatusTooManyRequests}
+	if len(res.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(res.Results), len(want))
+	}
+	for i, status := range want {
+		if res.Results[i].Status != status {
+			t.Errorf("operation %d: got status %d, want %d", i, res.Results[i].Status, status)
+		}
+	}
+	if res.Results[2].Headers["Retry-After"] == "" {
+		t.Error("the rejected operation has no Retry-After header")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/validator"
+)
+
+// defaultMaxBodyBytes applies to routes registered without maxBody.
+const defaultMaxBodyBytes = 1_048_576
+
+// bindError describes why a request body could not be bound. Errors caused by
+// a single field carry its name and are reported as validation failures.
+type bindError struct {
+	status  int
+	field   string
+	message string
+}
+
+func (e *bindError) Error() string {
+	if e.field != "" {
+		return fmt.Sprintf("%s %s", e.field, e.message)
+	}
+	return e.message
+}
+
+// maxBody sets the largest body accepted by bind on the requests next serves.
+func (app *application) maxBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), maxBodyBytesKey, maxBytes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func maxBodyBytes(r *http.Request) int64 {
+	if n, ok := r.Context().Value(maxBodyBytesKey).(int64); ok {
+		return n
+	}
+	return defaultMaxBodyBytes
+}
+
+// bind decodes the body of r into dst, accepting only the given media types
+// (application/json when none are given), and writes the error response
+// itself when it fails.
+func (app *application) bind(w http.ResponseWriter, r *http.Request, dst interface{}, mediaTypes ...string) bool {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{mediaTypeJSON}
+	}
+	err := decodeBody(w, r, dst, mediaTypes)
+	if err != nil {
+		app.bindErrorResponse(w, r, err, mediaTypes)
+		return false
+	}
+	return true
+}
+
+// bindErrorResponse reports an error returned while binding a body.
+func (app *application) bindErrorResponse(w http.ResponseWriter, r *http.Request, err error, mediaTypes []string) {
+	var be *bindError
+	if !errors.As(err, &be) {
+		panic(err)
+	}
+	switch {
+	case be.status == http.StatusUnsupportedMediaType:
+		app.unsupportedMediaTypeResponse(w, r, mediaTypes)
+	case be.status == http.StatusRequestEntityTooLarge:
+		app.requestTooLargeResponse(w, r, maxBodyBytes(r))
+	case be.field != "":
+		app.failedValidationResponse(w, r, map[string]string{be.field: be.message})
+	default:
+		app.badRequestResponse(w, r, be)
+	}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}, mediaTypes []string) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !validator.In(mediaType, mediaTypes...) {
+		return &bindError{status: http.StatusUnsupportedMediaType, message: "unsupported content type"}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes(r))
+	return decodeJSON(r.Body, dst)
+}
+
+// decodeJSON decodes a single JSON value from body into dst, rejecting unknown
+// fields and trailing data.
+func decodeJSON(body io.Reader, dst interface{}) error {
+	tooLarge := &bindError{status: http.StatusRequestEntityTooLarge, message: "body too large"}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		switch {
+		case errors.As(err, &syntaxError):
+			return &bindError{message: fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &bindError{message: "body contains badly-formed JSON"}
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return &bindError{field: unmarshalTypeError.Field, message: "must be " + jsonTypeName(unmarshalTypeError.Type)}
+			}
+			return &bindError{message: fmt.Sprintf("body must be %s", jsonTypeName(unmarshalTypeError.Type))}
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			return &bindError{field: "runtime", message: `must be in the format "<minutes> mins"`}
+		case errors.Is(err, io.EOF):
+			return &bindError{message: "body must not be empty"}
+		case errors.As(err, &invalidUnmarshalError):
+			return err
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return &bindError{field: field, message: "is not a known field"}
+		case err.Error() == "http: request body too large":
+			return tooLarge
+		default:
+			return &bindError{message: err.Error()}
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		if err != nil && err.Error() == "http: request body too large" {
+			return tooLarge
+		}
+		return &bindError{message: "body must only contain a single JSON value"}
+	}
+	return nil
+}
+
+// jsonTypeName names the JSON type a Go value of type t is decoded from.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	}
+	return "a valid value"
+}
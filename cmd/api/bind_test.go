@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		want        bindError
+	}{
+		{"valid", "application/json", `{"title":"Moana","runtime":"107 mins"}`, 0, bindError{}},
+		{"parameters in the content type", "application/json; charset=utf-8", `{"title":"Moana"}`, 0, bindError{}},
+		{"missing content type", "", `{}`, 0, bindError{status: http.StatusUnsupportedMediaType, message: "unsupported content type"}},
+		{"other content type", "text/plain", `{}`, 0, bindError{status: http.StatusUnsupportedMediaType, message: "unsupported content type"}},
+		{"syntax error", "application/json", `{"title":}`, 0, bindError{message: "body contains badly-formed JSON (at character 10)"}},
+		{"truncated", "application/json", `{"title":"Moana"`, 0, bindError{message: "body contains badly-formed JSON"}},
+		{"field of the wrong type", "application/json", `{"year":"2016"}`, 0, bindError{field: "year", message: "must be an integer"}},
+		{"body of the wrong type", "application/json", `[]`, 0, bindError{message: "body must be an object"}},
+		{"runtime format", "application/json", `{"runtime":107}`, 0, bindError{field: "runtime", message: `must be in the format "<minutes> mins"`}},
+		{"empty", "application/json", ``, 0, bindError{message: "body must not be empty"}},
+		{"unknown field", "application/json", `{"rating":5}`, 0, bindError{field: "rating", message: "is not a known field"}},
+		{"two values", "application/json", `{}{}`, 0, bindError{message: "body must only contain a single JSON value"}},
+		{"too large", "application/json", `{"title":"Moana"}`, 8, bindError{status: http.StatusRequestEntityTooLarge, message: "body too large"}},
+		{"too large after the value", "application/json", `{}` + strings.Repeat(" ", 16), 8, bindError{status: http.StatusRequestEntityTooLarge, message: "body too large"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.maxBytes > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), maxBodyBytesKey, tt.maxBytes))
+			}
+			var dst struct {
+				Title   string       `json:"title"`
+				Year    int32        `json:"year"`
+				Runtime data.Runtime `json:"runtime"`
+				Genres  []string     `json:"genres"`
+			}
+			err := decodeBody(httptest.NewRecorder(), r, &dst, []string{mediaTypeJSON})
+
+			if tt.want == (bindError{}) {
+				if err != nil {
+					t.Fatalf("got error %v", err)
+				}
+				return
+			}
+			var be *bindError
+			if !errors.As(err, &be) {
+				t.Fatalf("got error %v, want a bind error", err)
+			}
+			if *be != tt.want {
+				t.Errorf("got %+v, want %+v", *be, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindReportsFieldErrorsAsValidationFailures(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"year":"2016"}`, http.StatusUnprocessableEntity},
+		{`{"title":}`, http.StatusBadRequest},
+		{`{"title":"` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		app, _ := newTestApplication(t)
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", mediaTypeJSON)
+		r = r.WithContext(context.WithValue(r.Context(), maxBodyBytesKey, int64(32)))
+		w := httptest.NewRecorder()
+		var dst struct {
+			Title string `json:"title"`
+			Year  int32  `json:"year"`
+		}
+		if app.bind(w, r, &dst) {
+			t.Fatalf("%s: bind succeeded", tt.body)
+		}
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
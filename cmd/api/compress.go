@@ -0,0 +1,177 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressionEncodings are the supported content codings, in order of
+// preference when the client weighs them equally.
+var compressionEncodings = []string{"br", "gzip"}
+
+// compressibleTypes are the Content-Type prefixes worth compressing.
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/msgpack",
+	"application/yaml",
+	"text/",
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() interface{} { return brotli.NewWriter(io.Discard) }}
+)
+
+// compress encodes responses with the coding negotiated through
+// Accept-Encoding. Bodies are buffered up to the configured minimum size, so
+// that small responses are sent as they are.
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := app.config().Compression
+		if !cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiate(r.Header.Get("Accept-Encoding"), compressionEncodings, matchEncoding)
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.MinSize}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		if !cw.compressible() {
+			cw.decide(false)
+		} else {
+			cw.buf = append(cw.buf, p...)
+			if len(cw.buf) < cw.minSize {
+				return len(p), nil
+			}
+			cw.decide(true)
+			return len(p), nil
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush starts sending whatever was buffered, compressed if anything was.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.decide(len(cw.buf) > 0 && cw.compressible())
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			return nil
+		}
+		cw.decide(false)
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *brotli.Writer:
+		brotliWriters.Put(enc)
+	}
+	cw.enc = nil
+	return err
+}
+
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide sends the headers and the buffered body, through a new encoder when
+// compressing.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		switch cw.encoding {
+		case "gzip":
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.enc = gw
+		case "br":
+			bw := brotliWriters.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.enc = bw
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return
+	}
+	if cw.enc != nil {
+		cw.enc.Write(cw.buf)
+	} else {
+		cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+}
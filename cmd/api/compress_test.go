@@ -0,0 +1,90 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressWriter(t *testing.T) {
+	large := strings.Repeat(`{"title":"Moana"}`, 100)
+	tests := []struct {
+		name        string
+		encoding    string
+		contentType string
+		status      int
+		body        []string
+		flush       bool
+		want        string
+	}{
+		{"small body", "gzip", "application/json", http.StatusOK, []string{`{"a":1}`}, false, ""},
+		{"large body", "gzip", "application/json", http.StatusOK, []string{large}, false, "gzip"},
+		{"brotli", "br", "application/json", http.StatusOK, []string{large}, false, "br"},
+		{"body over the minimum in pieces", "gzip", "text/csv", http.StatusOK, []string{large[:600], large[600:]}, false, "gzip"},
+		{"incompressible type", "gzip", "image/png", http.StatusOK, []string{large}, false, ""},
+		{"no content", "gzip", "application/json", http.StatusNoContent, nil, false, ""},
+		{"flushed small body", "gzip", "application/json", http.StatusOK, []string{`{"a":1}`}, true, "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cw := &compressWriter{ResponseWriter: rec, encoding: tt.encoding, minSize: 1024}
+			cw.Header().Set("Content-Type", tt.contentType)
+			cw.WriteHeader(tt.status)
+			for _, b := range tt.body {
+				cw.Write([]byte(b))
+			}
+			if tt.flush {
+				cw.Flush()
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("got Content-Encoding %q, want %q", got, tt.want)
+			}
+			var r io.Reader = rec.Body
+			switch tt.want {
+			case "gzip":
+				gr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = gr
+			case "br":
+				r = brotli.NewReader(rec.Body)
+			}
+			body, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(body), strings.Join(tt.body, ""); got != want {
+				t.Errorf("got body of %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestCompressWriterLeavesEncodedBodiesAlone(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: rec, encoding: "gzip", minSize: 0}
+	cw.Header().Set("Content-Type", "application/json")
+	cw.Header().Set("Content-Encoding", "identity")
+	cw.Write([]byte(`{"a":1}`))
+	cw.Close()
+	if got := rec.Header().Get("Content-Encoding"); got != "identity" {
+		t.Errorf("got Content-Encoding %q, want identity", got)
+	}
+	if got := rec.Body.String(); got != `{"a":1}` {
+		t.Errorf("got body %q", got)
+	}
+}
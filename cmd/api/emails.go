@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
+	"github.com/jersonsatoru/lets-go-further/internal/validator"
+)
+
+var errEmailSuppressed = errors.New("recipient is on the suppression list")
+
+// queueEmail records an email and schedules its delivery through the outbox.
+// tx should be bound to the transaction that creates whatever the email is
+// about, so that both are committed together.
+func (app *application) queueEmail(ctx context.Context, tx data.Models, recipient, locale, templateFile string, templateData map[string]interface{}) error {
+	email := &data.Email{
+		Template:  templateFile,
+		Locale:    locale,
+		Recipient: recipient,
+		Status:    data.EmailQueued,
+	}
+	err := tx.Emails.Insert(ctx, email)
+	if err != nil {
+		return err
+	}
+	entry, err := data.NewOutboxEntry(data.TopicEmail, data.EmailMessage{
+		EmailID:   email.ID,
+		Recipient: recipient,
+		Locale:    locale,
+		Template:  templateFile,
+		Data:      templateData,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Outbox.Insert(ctx, entry)
+}
+
+// sendEmail delivers a recorded email unless its recipient is suppressed, and
+// stores the outcome of the attempt through models. The outbox relay passes
+// the models bound to its transaction: with a single open connection, using
+// app.models there would wait forever for the one the transaction holds.
+func (app *application) sendEmail(ctx context.Context, models data.Models, msg *data.EmailMessage) error {
+	suppressed, err := models.Suppressions.Exists(ctx, msg.Recipient)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		err = models.Emails.SetStatus(ctx, msg.EmailID, data.EmailSuppressed)
+		if err != nil {
+			return err
+		}
+		return errEmailSuppressed
+	}
+
+	_, span := tracing.StartKind(ctx, "mailer.Send", tracing.KindClient,
+		tracing.String("mailer.template", msg.Template),
+		tracing.String("mailer.locale", msg.Locale),
+		tracing.String("mailer.transport", app.config().Mailer.Transport))
+	messageID, sendErr := app.mailer.Send(msg.Recipient, msg.Locale, msg.Template, msg.Data)
+	span.SetAttributes(tracing.String("mailer.message_id", messageID))
+	span.RecordError(sendErr)
+	span.End()
+	// The email is gone once Send succeeds: failing here would only get it
+	// sent again, so an attempt that cannot be recorded is just logged.
+	err = models.Emails.RecordAttempt(ctx, msg.EmailID, messageID, sendErr)
+	if err != nil {
+		app.logger(ctx).Errorw("recording email attempt failed", "error", err.Error(), "emailID", msg.EmailID, "messageID", messageID)
+	}
+	return sendErr
+}
+
+type mailerEventInput struct {
+	Type      string `json:"type" validate:"required,enum=bounce|complaint"`
+	Recipient string `json:"recipient" validate:"required,format=email"`
+	MessageID string `json:"message_id"`
+	Permanent bool   `json:"permanent"`
+	Reason    string `json:"reason"`
+}
+
+// requireWebhookSecret admits the requests carrying the configured mailer
+// webhook secret in X-Webhook-Secret.
+func (app *application) requireWebhookSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := string(app.config().Mailer.WebhookSecret)
+		given := r.Header.Get("X-Webhook-Secret")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(given)) != 1 {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateRecipient checks an email address given as recipient. Handlers
+// check it themselves because request validation can be switched off.
+func validateRecipient(v *validator.Validator, recipient string) {
+	ev := validator.New()
+	data.ValidateEmail(ev, recipient)
+	if msg, ok := ev.Errors["email"]; ok {
+		v.AddError("recipient", msg)
+	}
+}
+
+func (app *application) mailerEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input mailerEventInput
+	if !app.bind(w, r, &input) {
+		return
+	}
+	v := validator.New()
+	v.Check(validator.In(input.Type, "bounce", "complaint"), "type", "must be bounce or complaint")
+	validateRecipient(v, input.Recipient)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	status := data.EmailBounced
+	if input.Type == "complaint" {
+		status = data.EmailComplained
+	}
+	if input.Type == "complaint" || input.Permanent {
+		reason := input.Type
+		if input.Reason != "" {
+			reason = input.Type + ": " + input.Reason
+		}
+		err := app.models.Suppressions.Insert(r.Context(), input.Recipient, reason)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if input.MessageID != "" {
+		err := app.models.Emails.SetStatusForMessage(r.Context(), input.MessageID, status)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	app.logger(r.Context()).Infow("mailer event",
+		"type", input.Type,
+		"recipient", input.Recipient,
+		"messageID", input.MessageID,
+		"permanent", input.Permanent)
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"message": "event processed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,80 +1,160 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
-	"go.uber.org/zap"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/i18n"
 )
 
+// problemTypePrefix turns an error code into the URI identifying its problem
+// type. Clients should match on the code rather than on the detail, which is
+// translated.
+const problemTypePrefix = "urn:greenlight:problem:"
+
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// errorResponse writes an RFC 7807 application/problem+json document. code is
+// stable and machine readable; extensions are added as top-level members.
 func (app *application) errorResponse(
-	w http.ResponseWriter, r *http.Request, status int, message interface{}) {
+	w http.ResponseWriter, r *http.Request, status int, code, detail string, extensions envelope) {
 	env := envelope{
-		"error": message,
+		"type":     problemTypePrefix + code,
+		"title":    http.StatusText(status),
+		"status":   status,
+		"detail":   detail,
+		"instance": r.URL.Path,
+		"code":     code,
+	}
+	if info := requestInfoFromContext(r.Context()); info != nil {
+		env["request_id"] = info.id
+	}
+	for key, value := range extensions {
+		env[key] = value
 	}
 
-	err := app.writeJSON(w, status, env, nil)
+	headers := http.Header{"Content-Type": []string{"application/problem+json"}}
+	err := app.writeJSON(w, status, env, headers)
 	if err != nil {
-		zap.S().Errorw(err.Error())
+		app.logger(r.Context()).Errorw(err.Error())
 		w.WriteHeader(500)
 	}
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	zap.S().Errorw(err.Error())
-	message := "server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.logger(r.Context()).Errorw(err.Error())
+	message := app.translate(r, "error.server")
+	app.errorResponse(w, r, http.StatusInternalServerError, "server_error", message, nil)
 }
 
 func (app *application) notFoundErrorResponse(w http.ResponseWriter, r *http.Request) {
-	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	message := app.translate(r, "error.not_found")
+	app.errorResponse(w, r, http.StatusNotFound, "not_found", message, nil)
 }
 
 func (app *application) methodNotAllowedError(w http.ResponseWriter, r *http.Request) {
-	message := fmt.Sprintf("the %s method it not suppported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	message := app.translate(r, "error.method_not_allowed", r.Method)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", message, nil)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, offers []string) {
+	message := app.translate(r, "error.not_acceptable")
+	app.errorResponse(w, r, http.StatusNotAcceptable, "not_acceptable", message, envelope{"acceptable": offers})
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported []string) {
+	message := app.translate(r, "error.unsupported_media_type")
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", message, envelope{"supported": supported})
+}
+
+func (app *application) requestTooLargeResponse(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	message := app.translate(r, "error.request_too_large", maxBytes)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, "request_too_large", message, envelope{"max_bytes": maxBytes})
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	message := i18n.TranslateText(app.requestLocale(r), err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", message, nil)
 }
 
+// failedValidationResponse reports every invalid field as an invalid-params
+// entry, sorted by name so that responses are stable.
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	locale := app.requestLocale(r)
+	params := make([]invalidParam, 0, len(errors))
+	for name, reason := range errors {
+		params = append(params, invalidParam{Name: name, Reason: i18n.TranslateText(locale, reason)})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	message := app.translate(r, "error.validation_failed")
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", message, envelope{"invalid-params": params})
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	message := app.translate(r, "error.edit_conflict")
+	app.errorResponse(w, r, http.StatusConflict, "edit_conflict", message, nil)
+}
+
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	message := i18n.TranslateText(app.requestLocale(r), err.Error())
+	app.errorResponse(w, r, http.StatusConflict, "patch_test_failed", message, nil)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := app.translate(r, "error.idempotency_key_in_use")
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_in_use", message, nil)
+}
+
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := app.translate(r, "error.idempotency_key_mismatch")
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "idempotency_key_mismatch", message, nil)
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
-	message := "rate limite exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	message := app.translate(r, "error.rate_limit_exceeded")
+	app.errorResponse(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", message, nil)
+}
+
+func (app *application) dailyQuotaExceededResponse(w http.ResponseWriter, r *http.Request, tier data.QuotaTier) {
+	resetsAt := data.QuotaResetTime(time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetsAt).Seconds())+1))
+	message := app.translate(r, "error.daily_quota_exceeded")
+	app.errorResponse(w, r, http.StatusTooManyRequests, "daily_quota_exceeded", message, envelope{
+		"quota": envelope{
+			"tier":        tier.Name,
+			"daily_limit": tier.DailyLimit,
+			"resets_at":   resetsAt,
+		},
+	})
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
-	message := "invalid authentication crendentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	message := app.translate(r, "error.invalid_credentials")
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", message, nil)
 }
 
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
-	message := "invalid token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	message := app.translate(r, "error.invalid_token")
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_token", message, nil)
 }
 
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	message := app.translate(r, "error.authentication_required")
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", message, nil)
 }
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	message := app.translate(r, "error.inactive_account")
+	app.errorResponse(w, r, http.StatusForbidden, "inactive_account", message, nil)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	message := app.translate(r, "error.not_permitted")
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", message, nil)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestFailedValidationResponseTranslatesReasons(t *testing.T) {
+	app, _ := newTestApplication(t)
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+	r.Header.Set("Accept-Language", "en")
+	user := &data.User{ID: 1, Locale: "pt-BR"}
+	r = r.WithContext(context.WithValue(r.Context(), contextUser("user"), user))
+	w := httptest.NewRecorder()
+
+	app.failedValidationResponse(w, r, map[string]string{
+		"title": "must be provided",
+		"year":  "must be greater than or equal to 1888",
+	})
+
+	var body struct {
+		Detail        string         `json:"detail"`
+		InvalidParams []invalidParam `json:"invalid-params"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Detail != "a requisição contém parâmetros inválidos" {
+		t.Errorf("detail = %q", body.Detail)
+	}
+	want := []invalidParam{
+		{Name: "title", Reason: "deve ser informado"},
+		{Name: "year", Reason: "deve ser maior ou igual a 1888"},
+	}
+	if len(body.InvalidParams) != len(want) {
+		t.Fatalf("invalid-params = %v, want %v", body.InvalidParams, want)
+	}
+	for i := range want {
+		if body.InvalidParams[i] != want[i] {
+			t.Errorf("invalid-params[%d] = %v, want %v", i, body.InvalidParams[i], want[i])
+		}
+	}
+}
+
+func TestBadRequestResponseTranslatesDetail(t *testing.T) {
+	app, _ := newTestApplication(t)
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+	r.Header.Set("Accept-Language", "pt-BR,en;q=0.5")
+	w := httptest.NewRecorder()
+
+	app.badRequestResponse(w, r, errors.New("body contains badly-formed JSON (at character 7)"))
+
+	var body struct {
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := "o corpo contém JSON malformado (no caractere 7)"; body.Detail != want {
+		t.Errorf("detail = %q, want %q", body.Detail, want)
+	}
+}
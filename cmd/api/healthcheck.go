@@ -1,20 +1,121 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/mailer"
 )
 
+// healthCheckHandler is the original shallow health check. It does not run
+// the dependency checks, /v1/health/ready does.
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	status := "available"
+	if app.shuttingDown() {
+		status = "unavailable"
+	}
 	w.Header().Set("content-type", "application/json")
 	err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"port":       app.cfg.port,
-		"env":        app.cfg.env,
+		"port":       app.config().Port,
+		"env":        app.config().Env,
 		"apiVersion": version,
-		"status":     "available",
+		"status":     status,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// livenessHandler only tells whether the process can serve requests at all;
+// it never touches a dependency.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if app.shuttingDown() {
+		err := app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "shutting_down"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	report := app.health.Run()
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	err := app.writeJSON(w, status, envelope{"status": report.Status, "checked_at": report.CheckedAt, "checks": report.Checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) shuttingDown() bool {
+	return atomic.LoadInt32(&app.stopping) == 1
+}
+
+func (app *application) registerHealthChecks(db *sql.DB) {
+	app.health.Register("database", func(ctx context.Context) (map[string]interface{}, error) {
+		start := time.Now()
+		err := db.PingContext(ctx)
+		details := map[string]interface{}{
+			"latency_ms":       float64(time.Since(start).Microseconds()) / 1000,
+			"open_connections": db.Stats().OpenConnections,
+		}
+		return details, err
+	})
+
+	app.health.Register("migrations", func(ctx context.Context) (map[string]interface{}, error) {
+		version, dirty, err := app.migrator.Version(ctx)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{"version": version, "dirty": dirty, "expected": app.migrator.Latest()}
+		switch {
+		case dirty:
+			return details, fmt.Errorf("migration %d is dirty", version)
+		case version < app.migrator.Latest():
+			return details, errors.New("schema is behind the code")
+		}
+		return details, nil
+	})
+
+	if pinger, ok := app.mailer.(mailer.Pinger); ok {
+		app.health.Register("smtp", func(ctx context.Context) (map[string]interface{}, error) {
+			start := time.Now()
+			err := pinger.Ping(ctx)
+			return map[string]interface{}{"latency_ms": float64(time.Since(start).Microseconds()) / 1000}, err
+		})
+	}
+
+	app.health.Register("outbox", func(ctx context.Context) (map[string]interface{}, error) {
+		maxBacklog := app.config().Health.MaxOutboxBacklog
+		details := map[string]interface{}{"max_backlog": maxBacklog}
+		total := 0
+		for topic := range app.outboxSinks() {
+			n, err := app.models.Outbox.CountPending(ctx, topic)
+			if err != nil {
+				return details, err
+			}
+			details[topic] = n
+			total += n
+		}
+		details["backlog"] = total
+		if maxBacklog > 0 && total > maxBacklog {
+			return details, errors.New("outbox backlog is above the limit")
+		}
+		return details, nil
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/health"
+)
+
+func TestHealthCheckIsShallow(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.health = health.New(time.Second, time.Second)
+	checked := false
+	app.health.Register("database", func(ctx context.Context) (map[string]interface{}, error) {
+		checked = true
+		return nil, errors.New("connection refused")
+	})
+
+	w := httptest.NewRecorder()
+	app.healthCheckHandler(w, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "available" {
+		t.Errorf("status = %q, want available", body.Status)
+	}
+	if checked {
+		t.Error("the healthcheck ran the dependency checks")
+	}
+}
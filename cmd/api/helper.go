@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/i18n"
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
+	"go.uber.org/zap"
 )
 
 type envelope map[string]interface{}
@@ -23,52 +25,40 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(status)
 	w.Write([]byte(b))
 	return nil
 }
 
-func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	err := dec.Decode(dst)
-	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarchalTypeError *json.UnmarshalTypeError
-		var invalidUnmarchalError *json.InvalidUnmarshalError
-		switch {
-		case errors.As(err, &syntaxError):
-			message := fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
-			return fmt.Errorf(message)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return fmt.Errorf("body contains badly-formed JSON")
-		case errors.As(err, &unmarchalTypeError):
-			if unmarchalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrectly JSON type for field %q", unmarchalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrectly JSON type (at character %d)", unmarchalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
-		case errors.As(err, &invalidUnmarchalError):
-			panic(err)
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown field %s", field)
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("bodu must not be larger than %d bytes", maxBytes)
-		default:
-			return err
-		}
+// logger returns the global logger annotated with the request ID and the
+// trace and span IDs of ctx, so that log lines can be matched with the
+// client's call and with their traces.
+func (app *application) logger(ctx context.Context) *zap.SugaredLogger {
+	l := zap.S()
+	if info := requestInfoFromContext(ctx); info != nil {
+		l = l.With("request_id", info.id)
 	}
+	if traceID := tracing.TraceIDFromContext(ctx); traceID != "" {
+		l = l.With("trace_id", traceID, "span_id", tracing.SpanIDFromContext(ctx))
+	}
+	return l
+}
 
-	err = dec.Decode(&struct{}{})
-	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+// requestLocale prefers the authenticated user's stored locale and falls back
+// to the Accept-Language header.
+func (app *application) requestLocale(r *http.Request) string {
+	user, ok := r.Context().Value(contextUser("user")).(*data.User)
+	if ok && !user.IsAnonymous() && user.Locale != "" {
+		return user.Locale
 	}
-	return nil
+	return i18n.Match(r.Header.Get("Accept-Language"))
+}
+
+func (app *application) translate(r *http.Request, key string, args ...interface{}) string {
+	return i18n.Translate(app.requestLocale(r), key, args...)
 }
 
 func (app *application) readString(qs url.Values, key string, defaultString string) string {
@@ -86,7 +76,7 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "mest be an integer")
+		v.AddError(key, "must be an integer")
 		return defaultValue
 	}
 	return i
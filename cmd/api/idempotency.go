@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+const (
+	maxIdempotencyKeyLength    = 255
+	maxIdempotentResponseBytes = 1 << 20
+	idempotencySweepInterval   = time.Hour
+)
+
+// idempotentHeaders are the response headers replayed with a stored
+// response. The others are set again by the middleware serving the retry.
+var idempotentHeaders = []string{"Content-Type", "Content-Language", "Location"}
+
+// idempotent stores the first response to a request carrying an
+// Idempotency-Key header, per caller and key, and replays it to retries of
+// the same request. A retry arriving while the first request is still being
+// served is rejected, as is a different request reusing the key. Server
+// errors are not stored so that the request can be retried.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, fmt.Errorf("Idempotency-Key must not be more than %d bytes long", maxIdempotencyKeyLength))
+			return
+		}
+
+		// Bodies over the limit are left for bind to reject.
+		limit := maxBodyBytes(r)
+		body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > limit {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+		hash.Write(body)
+		requestHash := hash.Sum(nil)
+
+		cfg := app.config().Idempotency
+		scope := idempotencyScope(r)
+		claim := newIdempotencyClaim()
+		stored, err := app.models.Idempotency.Begin(r.Context(), scope, key, claim, requestHash, cfg.Lock)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyInUse):
+				app.idempotencyKeyInUseResponse(w, r)
+			case errors.Is(err, data.ErrIdempotencyKeyMismatch):
+				app.idempotencyKeyMismatchResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if stored != nil {
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// The request context may be gone, the key must be released anyway.
+			if err := app.models.Idempotency.Release(context.Background(), scope, key, claim); err != nil {
+				app.logger(r.Context()).Errorw("releasing idempotency key failed", "error", err.Error())
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError || rec.overflow {
+			return
+		}
+		err = app.models.Idempotency.Complete(context.Background(), scope, key, claim, &data.IdempotentResponse{
+			Status: rec.status,
+			Header: rec.header,
+			Body:   rec.body.Bytes(),
+		}, cfg.TTL)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyClaimLost):
+				app.logger(r.Context()).Warnw("idempotency key outlived its lock, the response was not stored", "lock", cfg.Lock.String())
+			default:
+				app.logger(r.Context()).Errorw("storing idempotent response failed", "error", err.Error())
+			}
+			return
+		}
+		completed = true
+	})
+}
+
+// newIdempotencyClaim identifies one claim on an idempotency key, so that a
+// request outliving its lock cannot store or release the claim of a retry.
+func newIdempotencyClaim() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// idempotencyScope identifies the caller owning an idempotency key: the
+// authenticated user, or for anonymous requests the address of the peer.
+// Unlike the rate limits it ignores X-Forwarded-For and X-Real-IP, which any
+// caller could set to read the responses stored for another one.
+func idempotencyScope(r *http.Request) string {
+	if user, ok := r.Context().Value(contextUser("user")).(*data.User); ok && !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// idempotencyRecorder passes the response through while keeping a copy of
+// it, up to maxIdempotentResponseBytes of body.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	rec.header = make(http.Header)
+	for _, name := range idempotentHeaders {
+		if values := rec.Header().Values(name); len(values) > 0 {
+			rec.header[name] = values
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.body.Len()+len(b) > maxIdempotentResponseBytes {
+		rec.overflow = true
+	} else {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// startIdempotencySweeper deletes the expired idempotency keys until ctx is
+// done. Expired keys are claimed again by Begin anyway, this only keeps the
+// table small.
+func (app *application) startIdempotencySweeper(ctx context.Context) {
+	app.background("idempotency sweeper", func() {
+		ticker := time.NewTicker(idempotencySweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := app.models.Idempotency.DeleteExpired(ctx)
+				if err != nil {
+					app.logger(ctx).Errorw("deleting expired idempotency keys failed", "error", err.Error())
+					continue
+				}
+				app.logger(ctx).Infow("deleted expired idempotency keys", "count", n)
+			}
+		}
+	})
+}
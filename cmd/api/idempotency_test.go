@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestIdempotent(t *testing.T) {
+	body := `{"name":"Alice","email":"alice@example.com","password":"pa55word"}`
+	hash := sha256.Sum256([]byte("POST /v1/users\n" + body))
+	tests := []struct {
+		name    string
+		claimed bool
+		row     []driver.Value
+		status  int
+		served  bool
+		want    int
+		replay  bool
+		ttl     time.Duration
+	}{
+		{"new or expired key", true, nil, http.StatusCreated, true, http.StatusCreated, false, 24 * time.Hour},
+		{"stored for the configured ttl", true, nil, http.StatusCreated, true, http.StatusCreated, false, time.Hour},
+		{"server error releases the key", true, nil, http.StatusInternalServerError, true, http.StatusInternalServerError, false, 24 * time.Hour},
+		{"replay", false, []driver.Value{hash[:], 201, []byte(`{"Content-Type":["application/json"]}`), []byte(`{"user":{"id":1}}`)}, 0, false, http.StatusCreated, true, 24 * time.Hour},
+		{"in flight", false, []driver.Value{hash[:], nil, nil, nil}, 0, false, http.StatusConflict, false, 24 * time.Hour},
+		{"different request", false, []driver.Value{[]byte("other"), 201, []byte(`{}`), []byte(`{}`)}, 0, false, http.StatusUnprocessableEntity, false, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			app.config().Idempotency.TTL = tt.ttl
+			// Begin only claims a stored key again once it has expired.
+			claim := &sameClaim{}
+			begin := mock.ExpectQuery(`INSERT INTO idempotency_keys (?s:.*)WHERE idempotency_keys\.expires_at <= NOW\(\)`).
+				WithArgs("addr:192.0.2.1", "key-1", claim, hash[:], float64(60))
+			if tt.claimed {
+				begin.WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+			} else {
+				begin.WillReturnRows(sqlmock.NewRows([]string{"bool"}))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM idempotency_keys")).WithArgs("addr:192.0.2.1", "key-1").
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "header", "body"}).AddRow(tt.row...))
+			}
+			switch {
+			case tt.status == http.StatusCreated:
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys")).
+					WithArgs("addr:192.0.2.1", "key-1", claim, tt.status, []byte(`{"Content-Type":["application/json"]}`), []byte(`{"user":{"id":1}}`), tt.ttl.Seconds()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			case tt.status >= http.StatusInternalServerError:
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).WithArgs("addr:192.0.2.1", "key-1", claim).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			served := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("X-Request-ID", "not-replayed")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"user":{"id":1}}`))
+			})
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+			r.Header.Set("Idempotency-Key", "key-1")
+			r.Header.Set("X-Forwarded-For", "203.0.113.9")
+			r = r.WithContext(context.WithValue(r.Context(), contextUser("user"), data.AnonymousUser))
+			w := httptest.NewRecorder()
+			app.idempotent(next).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if served != tt.served {
+				t.Errorf("handler served = %v, want %v", served, tt.served)
+			}
+			if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tt.replay {
+				t.Errorf("replayed = %v, want %v", got, tt.replay)
+			}
+			if tt.replay && w.Body.String() != `{"user":{"id":1}}` {
+				t.Errorf("got replayed body %s", w.Body)
+			}
+		})
+	}
+}
+
+// sameClaim matches the claim passed to Begin, and then only that claim.
+type sameClaim struct {
+	value string
+}
+
+func (c *sameClaim) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return false
+	}
+	if c.value == "" {
+		c.value = s
+	}
+	return s == c.value
+}
+
+func TestIdempotentResponseIsNotStoredOverALostClaim(t *testing.T) {
+	app, mock := newTestApplication(t)
+	claim := &sameClaim{}
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).WithArgs("addr:192.0.2.1", "key-1", claim, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+	// A retry claimed the key after the lock expired, so nothing matches ours.
+	mock.ExpectExec(regexp.QuoteMeta("AND claim = $3 AND status IS NULL")).WithArgs("addr:192.0.2.1", "key-1", claim,
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).WithArgs("addr:192.0.2.1", "key-1", claim).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{}`))
+	r.Header.Set("Idempotency-Key", "key-1")
+	r = r.WithContext(context.WithValue(r.Context(), contextUser("user"), data.AnonymousUser))
+	w := httptest.NewRecorder()
+	app.idempotent(next).ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusCreated)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       *data.User
+		remoteAddr string
+		want       string
+	}{
+		{"authenticated", &data.User{ID: 7}, "192.0.2.1:1234", "user:7"},
+		{"anonymous", data.AnonymousUser, "192.0.2.1:1234", "addr:192.0.2.1"},
+		{"anonymous over IPv6", data.AnonymousUser, "[2001:db8::1]:1234", "addr:2001:db8::1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Forwarded-For", "203.0.113.9")
+		r.Header.Set("X-Real-IP", "203.0.113.9")
+		r = r.WithContext(context.WithValue(r.Context(), contextUser("user"), tt.user))
+		if got := idempotencyScope(r); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
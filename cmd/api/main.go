@@ -7,15 +7,22 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"runtime"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jersonsatoru/lets-go-further/internal/config"
 	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/health"
 	"github.com/jersonsatoru/lets-go-further/internal/mailer"
+	"github.com/jersonsatoru/lets-go-further/internal/migrate"
+	"github.com/jersonsatoru/lets-go-further/internal/openapi"
+	"github.com/jersonsatoru/lets-go-further/internal/ratelimit"
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
+	"github.com/jersonsatoru/lets-go-further/migrations"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
@@ -25,43 +32,21 @@ var (
 	buildTime string
 )
 
-type config struct {
-	port int
-	env  string
-	db   struct {
-		dsn          string
-		maxOpenConns int
-		maxIdleConns int
-		maxIdleTime  string
-	}
-	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
-	}
-	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
-	}
-	cors struct {
-		trustedOrigins []string
-	}
-	metrics struct {
-		totalRequestReceived   *expvar.Int
-		totalResponsesSent     *expvar.Int
-		totalRequestsTime      *expvar.Int
-		totalResponseStatusMap *expvar.Map
-	}
-}
-
 type application struct {
-	cfg    *config
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	cfg      atomic.Value
+	loader   *config.Loader
+	reloadMu sync.Mutex
+	models   data.Models
+	mailer   mailer.Mailer
+	limiter  ratelimit.Limiter
+	metrics  *appMetrics
+	health   *health.Checker
+	migrator *migrate.Migrator
+	openapi  *openapi.Document
+	dispatch http.Handler
+	sighup   chan os.Signal
+	stopping int32
+	jobs     backgroundJobs
 }
 
 type zapLogger struct {
@@ -73,8 +58,13 @@ func (zl *zapLogger) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// logLevel is shared by every logger so that it can be changed on reload.
+var logLevel = zap.NewAtomicLevel()
+
 func init() {
-	logger, err := zap.NewProduction()
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = logLevel
+	logger, err := zapConfig.Build()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -82,53 +72,65 @@ func init() {
 }
 
 func main() {
-	var cfg config
-	cfg.metrics.totalRequestReceived = expvar.NewInt("total_request_received")
-	cfg.metrics.totalRequestsTime = expvar.NewInt("total_request_time")
-	cfg.metrics.totalResponsesSent = expvar.NewInt("total_responses_sent")
-	cfg.metrics.totalResponseStatusMap = expvar.NewMap("total_response_status")
-
-	appPort, _ := strconv.Atoi(os.Getenv("APP_PORT"))
-	maxOpenConns, _ := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS"))
-	maxIdleConns, _ := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS"))
-	limiterRPS, _ := strconv.ParseFloat(os.Getenv("LIMITER_RPS"), 64)
-	limiterBurst, _ := strconv.Atoi(os.Getenv("LIMITER_BURST"))
-	limiterEnabled, _ := strconv.ParseBool(os.Getenv("LIMITER_ENABLED"))
-	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-	corsTrustedOrigins := os.Getenv("CORS_TRUSTED_ORIGINS")
-
-	flag.IntVar(&cfg.port, "port", appPort, "API server port")
-	flag.StringVar(&cfg.env, "env", os.Getenv("APP_ENV"), "Environment (development-staging-production)")
-	flag.StringVar(&cfg.db.dsn, "dsn", os.Getenv("DSN"), "Data Source Name (DSN)")
-	flag.IntVar(&cfg.db.maxOpenConns, "maxOpenConns", maxOpenConns, "Max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "maxIdleConns", maxIdleConns, "Max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "maxIdleTime", os.Getenv("DB_MAX_IDLE_TIME"), "Max idle connections")
-	flag.Float64Var(&cfg.limiter.rps, "limiterRPS", limiterRPS, "RPS Limiter")
-	flag.IntVar(&cfg.limiter.burst, "limiterBurst", limiterBurst, "BUrst Limiter")
-	flag.BoolVar(&cfg.limiter.enabled, "limiterEnabled", limiterEnabled, "Enable Limiter")
-
-	flag.StringVar(&cfg.smtp.host, "smtpHost", os.Getenv("SMTP_HOST"), "SMTP Host")
-	flag.IntVar(&cfg.smtp.port, "smtpPort", smtpPort, "SMTP Port")
-	flag.StringVar(&cfg.smtp.username, "smtpUsername", os.Getenv("SMTP_USERNAME"), "SMTP Username")
-	flag.StringVar(&cfg.smtp.password, "smtpPassword", os.Getenv("SMTP_PASSWORD"), "SMTP Password")
-	flag.StringVar(&cfg.smtp.sender, "smtpSender", os.Getenv("SMTP_SENDER"), "SMTP Sender")
-	if corsTrustedOrigins != "" {
-		cfg.cors.trustedOrigins = strings.Split(corsTrustedOrigins, " ")
-	}
 	displayVersion := flag.Bool("version", false, "Display version and exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration, with secrets redacted, and exit")
+	loader := config.NewLoader(flag.CommandLine)
 	flag.Parse()
+	sighup := notifySIGHUP()
+	cfg, err := loader.Load()
 	if *displayVersion {
 		fmt.Printf("Version: %s\n", version)
 		fmt.Printf("Build time: %s", buildTime)
 		os.Exit(0)
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	logLevel.SetLevel(cfg.Log.Level)
+	if *printConfig {
+		b, err := cfg.Dump()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(b)
+		os.Exit(0)
+	}
 
-	db, err := openDB(&cfg)
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tracer != nil {
+		tracing.SetGlobal(tracer)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Shutdown(ctx); err != nil {
+				zap.S().Errorw("flushing traces failed", "error", err.Error())
+			}
+		}()
+	}
+
+	db, err := openDB(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) == "migrate" {
+		if err = runMigrate(migrator, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err = checkSchema(migrator, cfg.DB.AutoMigrate); err != nil {
+		log.Fatal(err)
+	}
+
 	expvar.NewString("version").Set(version)
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
 		return runtime.NumGoroutine()
@@ -140,37 +142,48 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	m, err := newMailer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limiter, err := newLimiter(cfg, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	models := data.NewModels(db)
 	app := &application{
-		cfg:    &cfg,
-		models: data.NewModels(db),
-		mailer: mailer.New(
-			cfg.smtp.host,
-			cfg.smtp.port,
-			cfg.smtp.username,
-			cfg.smtp.password,
-			cfg.smtp.sender),
+		loader:   loader,
+		models:   models,
+		mailer:   m,
+		limiter:  limiter,
+		metrics:  newAppMetrics(db),
+		health:   health.New(cfg.Health.CacheTTL, cfg.Health.Timeout),
+		migrator: migrator,
+		openapi:  newOpenAPIDocument(),
+		sighup:   sighup,
 	}
+	app.cfg.Store(cfg)
+	app.registerHealthChecks(db)
 	zap.S().Infow("server is running, with database connection",
-		"port", cfg.port,
-		"env", cfg.env,
-		"db", true)
+		"port", cfg.Port,
+		"env", cfg.Env,
+		"db", true,
+		"mailer", cfg.Mailer.Transport,
+		"tracing", cfg.Tracing.Exporter)
 	if err = app.serve(); err != nil {
 		zap.S().Fatalw("server failed", zap.String("error", err.Error()))
 	}
 }
 
-func openDB(cfg *config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.db.dsn)
-	if err != nil {
-		return nil, err
-	}
-	d, err := time.ParseDuration(cfg.db.maxIdleTime)
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", string(cfg.DB.DSN))
 	if err != nil {
 		return nil, err
 	}
-	db.SetConnMaxIdleTime(d)
-	db.SetMaxIdleConns(cfg.db.maxIdleConns)
-	db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	db.SetConnMaxIdleTime(cfg.DB.MaxIdleTime)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	err = db.PingContext(ctx)
@@ -179,3 +192,59 @@ func openDB(cfg *config) (*sql.DB, error) {
 	}
 	return db, err
 }
+
+func newMailer(cfg *config.Config) (mailer.Mailer, error) {
+	switch cfg.Mailer.Transport {
+	case "smtp":
+		return mailer.NewSMTP(
+			cfg.SMTP.Host,
+			cfg.SMTP.Port,
+			cfg.SMTP.Username,
+			string(cfg.SMTP.Password),
+			cfg.SMTP.Sender), nil
+	case "file":
+		return mailer.NewFile(cfg.Mailer.Dir, cfg.SMTP.Sender)
+	case "log":
+		return mailer.NewLog(cfg.SMTP.Sender), nil
+	case "memory":
+		return mailer.NewMemory(cfg.SMTP.Sender), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer transport %q", cfg.Mailer.Transport)
+	}
+}
+
+func newLimiter(cfg *config.Config, db *sql.DB) (ratelimit.Limiter, error) {
+	switch cfg.Limiter.Store {
+	case "memory":
+		return ratelimit.NewMemory(), nil
+	case "postgres":
+		return ratelimit.NewPostgres(db), nil
+	default:
+		return nil, fmt.Errorf("unknown limiter store %q", cfg.Limiter.Store)
+	}
+}
+
+// newTracer returns nil when tracing is disabled, which turns every span into
+// a no-op.
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.Tracing.Exporter {
+	case "none":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewStdoutExporter()
+	case "file":
+		e, err := tracing.NewFileExporter(cfg.Tracing.File)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case "otlp":
+		exporter = tracing.NewOTLPHTTPExporter(cfg.Tracing.OTLPEndpoint)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Tracing.Exporter)
+	}
+	return tracing.NewTracer(cfg.Tracing.ServiceName, exporter, func(err error) {
+		zap.S().Errorw("exporting traces failed", "error", err.Error())
+	}), nil
+}
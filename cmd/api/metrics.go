@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/metrics"
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
+)
+
+type appMetrics struct {
+	registry           *metrics.Registry
+	requests           *metrics.CounterVec
+	requestDuration    *metrics.HistogramVec
+	rateLimitRejection *metrics.CounterVec
+	mailQueueDepth     *metrics.Gauge
+
+	totalRequestReceived   *expvar.Int
+	totalResponsesSent     *expvar.Int
+	totalRequestsTime      *expvar.Int
+	totalResponseStatusMap *expvar.Map
+}
+
+func newAppMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+	m := &appMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("http_requests_total",
+			"Number of HTTP requests handled.", "route", "method", "status"),
+		requestDuration: reg.NewHistogramVec("http_request_duration_seconds",
+			"Time spent handling HTTP requests.", metrics.DefaultBuckets, "route", "method", "status"),
+		rateLimitRejection: reg.NewCounterVec("rate_limit_rejections_total",
+			"Number of requests rejected by a rate limit or quota.", "policy"),
+		mailQueueDepth: reg.NewGauge("mail_queue_depth",
+			"Emails waiting in the outbox to be delivered, as of the last outbox poll."),
+
+		totalRequestReceived:   expvar.NewInt("total_request_received"),
+		totalRequestsTime:      expvar.NewInt("total_request_time"),
+		totalResponsesSent:     expvar.NewInt("total_responses_sent"),
+		totalResponseStatusMap: expvar.NewMap("total_response_status"),
+	}
+
+	dbStat := func(f func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(db.Stats()) }
+	}
+	reg.NewGaugeFunc("db_open_connections", "Established database connections, in use and idle.",
+		dbStat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("db_in_use_connections", "Database connections currently in use.",
+		dbStat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("db_idle_connections", "Idle database connections.",
+		dbStat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewGaugeFunc("db_max_open_connections", "Maximum number of open database connections.",
+		dbStat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("db_wait_count", "Total number of connections waited for.",
+		dbStat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewGaugeFunc("db_wait_duration_seconds", "Total time spent waiting for a connection.",
+		dbStat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+
+	return m
+}
+
+// instrument wraps the whole router so that every request, including the ones
+// answered by the not found and method not allowed handlers, is measured once.
+// The operations of a batch are dispatched through it too, and measured as
+// requests of their own. The route is only known once the router has matched
+// the request: its recordRoute middleware fills it in.
+func (app *application) instrument(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matched := &matchedRoute{template: "unmatched"}
+		method := metricMethod(r.Method)
+
+		ctx, span := tracing.StartKind(tracing.Extract(r.Context(), r.Header), method, tracing.KindServer,
+			tracing.String("http.method", r.Method),
+			tracing.String("http.target", r.URL.Path))
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			span.SetAttributes(tracing.String("http.request_id", info.id))
+		}
+		defer span.End()
+		r = r.WithContext(context.WithValue(ctx, matchedRouteKey, matched))
+
+		app.metrics.totalRequestReceived.Add(1)
+		m := httpsnoop.CaptureMetrics(router, w, r)
+		route := matched.template
+		span.SetName(method + " " + route)
+		span.SetAttributes(tracing.String("http.route", route), tracing.Int("http.status_code", m.Code))
+		if m.Code >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(m.Code)))
+		}
+		app.metrics.totalResponsesSent.Add(1)
+		app.metrics.totalRequestsTime.Add(m.Duration.Microseconds())
+		app.metrics.totalResponseStatusMap.Add(strconv.Itoa(m.Code), 1)
+
+		status := strconv.Itoa(m.Code)
+		app.metrics.requests.Inc(route, method, status)
+		app.metrics.requestDuration.Observe(m.Duration.Seconds(), route, method, status)
+		app.logAccess(r, route, m)
+	})
+}
+
+// matchedRoute holds the path template of the route serving a request.
+type matchedRoute struct {
+	template string
+}
+
+// recordRoute runs inside the router, once the route has been matched, and
+// reports its path template to instrument.
+func (app *application) recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matched, ok := r.Context().Value(matchedRouteKey).(*matchedRoute); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tpl, err := route.GetPathTemplate(); err == nil {
+					matched.template = tpl
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricMethod maps the request method to a label value, folding the
+// methods outside the standard set into OTHER so that clients cannot create
+// new series at will.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestMetricMethod(t *testing.T) {
+	tests := map[string]string{
+		"GET":     "GET",
+		"OPTIONS": "OPTIONS",
+		"PURGE":   "OTHER",
+		"get":     "OTHER",
+	}
+	for method, want := range tests {
+		if got := metricMethod(method); got != want {
+			t.Errorf("metricMethod(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestInstrumentLabelsRequestsWithTheMatchedRoute(t *testing.T) {
+	app, _ := newTestApplication(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/instrumented/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {})
+	router.Use(app.recordRoute)
+	h := app.instrument(router)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("PURGE", "/v1/instrumented/3", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/instrumented/4", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/not-instrumented", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var b bytes.Buffer
+	app.metrics.registry.WritePrometheus(&b)
+	for _, want := range []string{
+		`http_requests_total{route="/v1/instrumented/{id:[0-9]+}",method="OTHER",status="200"}`,
+		`http_requests_total{route="/v1/instrumented/{id:[0-9]+}",method="GET",status="200"}`,
+		`http_requests_total{route="unmatched",method="GET",status="404"}`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(b.String(), `method="PURGE"`) {
+		t.Error("metrics contain a series for the PURGE method")
+	}
+}
+
+func TestMetricsRequirePermission(t *testing.T) {
+	app, _ := newTestApplication(t)
+	for _, path := range []string{"/v1/metrics", "/v1/metrics/prometheus"} {
+		w := httptest.NewRecorder()
+		app.router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestOutboxPollSetsMailQueueDepth(t *testing.T) {
+	app, mock := newTestApplication(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox")).WithArgs(data.TopicEmail, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	app.updateMailQueueDepth(context.Background())
+
+	var b bytes.Buffer
+	app.metrics.registry.WritePrometheus(&b)
+	if !strings.Contains(b.String(), "\nmail_queue_depth 4\n") {
+		t.Error("mail_queue_depth was not set by the outbox poll")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,23 +2,91 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/felixge/httpsnoop"
+	"github.com/jersonsatoru/lets-go-further/internal/config"
 	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/ratelimit"
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
 	"github.com/tomasen/realip"
-	"golang.org/x/time/rate"
 )
 
 type contextUser string
 
+// contextKey identifies the values that the middleware stores in a request
+// context for the code it wraps.
+type contextKey int
+
+const (
+	requestInfoKey contextKey = iota
+	maxBodyBytesKey
+	matchedRouteKey
+	batchKey
+)
+
+// requestInfo is shared by every handler of a request. It is a pointer so
+// that middleware deeper in the chain, like authenticate, can fill it in for
+// the access log written by the outermost wrapper.
+type requestInfo struct {
+	id     string
+	userID int64
+}
+
+var requestIDRxp = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// requestID accepts the caller's X-Request-ID when it looks sane, generates
+// one otherwise, and echoes it on the response.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRxp.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// logAccess writes the access log line of a finished request.
+func (app *application) logAccess(r *http.Request, route string, m httpsnoop.Metrics) {
+	fields := []interface{}{
+		"method", r.Method,
+		"route", route,
+		"path", r.URL.Path,
+		"status", m.Code,
+		"bytes", m.Written,
+		"duration", m.Duration.Seconds(),
+		"clientIP", realip.FromRequest(r),
+	}
+	if info := requestInfoFromContext(r.Context()); info != nil && info.userID != 0 {
+		fields = append(fields, "userID", info.userID)
+	}
+	app.logger(r.Context()).Infow("request", fields...)
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -31,59 +99,93 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
-	if !app.cfg.limiter.enabled {
-		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-			next.ServeHTTP(rw, r)
-		})
-	}
-
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
+// rateLimit applies the policy configured for group. Every route in a group
+// shares the same budget per key. It wraps the authentication and permission
+// checks of a route so that requests rejected by them are counted too. Each
+// operation of a batch is charged to the policy of its own route, on top of
+// the batch route's.
+func (app *application) rateLimit(next http.Handler, group string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := app.config()
+		if !cfg.Limiter.Enabled {
+			next.ServeHTTP(w, r)
+			return
 		}
-	}()
-
-	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		ip := realip.FromRequest(r)
-		mu.Lock()
-		if _, found := clients[ip]; !found {
-			clients[ip] = &client{
-				limiter: rate.NewLimiter(rate.Limit(app.cfg.limiter.rps), app.cfg.limiter.burst),
-			}
+		policy := rateLimitPolicy(cfg, group)
+		res, err := app.limiter.Allow(r.Context(), app.rateLimitKey(r, policy.KeyBy), policy)
+		if err != nil {
+			app.logger(r.Context()).Errorw("rate limiter failed", "error", err.Error(), "policy", policy.Name)
+			next.ServeHTTP(w, r)
+			return
 		}
-		clients[ip].lastSeen = time.Now()
-		if !clients[ip].limiter.Allow() {
-			mu.Unlock()
-			app.rateLimitExceededResponse(rw, r)
+		reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", reset)
+		if !res.Allowed {
+			w.Header().Set("Retry-After", reset)
+			app.metrics.rateLimitRejection.Inc(policy.Name)
+			app.rateLimitExceededResponse(w, r)
 			return
 		}
-
-		mu.Unlock()
-		next.ServeHTTP(rw, r)
+		next.ServeHTTP(w, r)
 	})
 }
 
+// rateLimitPolicy returns the policy configured for group, or one derived
+// from the default rps and burst settings.
+func rateLimitPolicy(cfg *config.Config, group string) ratelimit.Policy {
+	if p, ok := cfg.Limiter.Policies[group]; ok {
+		return p
+	}
+	window := time.Second
+	if cfg.Limiter.RPS > 0 && cfg.Limiter.Burst > 0 {
+		window = time.Duration(float64(cfg.Limiter.Burst) / cfg.Limiter.RPS * float64(time.Second))
+	}
+	return ratelimit.Policy{
+		Name:   group,
+		Limit:  cfg.Limiter.Burst,
+		Window: window,
+		KeyBy:  ratelimit.KeyByIP,
+	}
+}
+
+// rateLimitKey identifies the caller for keyBy, falling back to the client IP
+// when the request carries no user or API key.
+func (app *application) rateLimitKey(r *http.Request, keyBy string) string {
+	switch keyBy {
+	case ratelimit.KeyByUser:
+		user, ok := r.Context().Value(contextUser("user")).(*data.User)
+		if ok && !user.IsAnonymous() {
+			return fmt.Sprintf("user:%d", user.ID)
+		}
+	case ratelimit.KeyByAPIKey:
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if key != "" {
+			hash := sha256.Sum256([]byte(key))
+			return "apikey:" + hex.EncodeToString(hash[:])
+		}
+	}
+	return "ip:" + realip.FromRequest(r)
+}
+
+// authenticate identifies the caller from its bearer token or client
+// certificate. The operations of a batch keep the user of the batch request.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Vary", "Authorization")
+		if batchFromContext(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
 		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			app.authenticateCertificate(next, w, r)
+			return
+		}
 		if authorizationHeader == "" {
 			ctx := context.WithValue(r.Context(), contextUser("user"), data.AnonymousUser)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -104,7 +206,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(token, data.ScopedAuthentication)
+		user, err := app.models.Users.GetForToken(r.Context(), token, data.ScopedAuthentication)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -115,11 +217,83 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			info.userID = user.ID
+		}
 		ctx := context.WithValue(r.Context(), contextUser("user"), user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticateCertificate identifies internal callers by the subject of the
+// client certificate they presented, which the TLS handshake has already
+// verified against the configured client CAs.
+func (app *application) authenticateCertificate(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	subject := r.TLS.VerifiedChains[0][0].Subject.String()
+	user, err := app.models.Users.GetForCertificate(r.Context(), subject)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if info := requestInfoFromContext(r.Context()); info != nil {
+		info.userID = user.ID
+	}
+	ctx := context.WithValue(r.Context(), contextUser("user"), user)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// enforceQuota applies the per-minute rate and the daily cap of the
+// authenticated user's tier. Anonymous requests are only subject to the
+// per-route limits. Counting a request is a synchronous write to the
+// database, made before the request is served. It runs inside a route, after
+// its rate limit and permission checks, so that rejected requests are not
+// counted. The operations of a batch are counted by batchHandler.
+func (app *application) enforceQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(contextUser("user")).(*data.User)
+		if !ok || user.IsAnonymous() || batchFromContext(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.config().Limiter.Enabled {
+			policy := ratelimit.Policy{
+				Name:   "tier-" + user.Quota.Name,
+				Limit:  user.Quota.RequestsPerMinute,
+				Window: time.Minute,
+				KeyBy:  ratelimit.KeyByUser,
+			}
+			res, err := app.limiter.Allow(r.Context(), app.rateLimitKey(r, policy.KeyBy), policy)
+			if err != nil {
+				app.logger(r.Context()).Errorw("rate limiter failed", "error", err.Error(), "policy", policy.Name)
+			} else if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+				app.metrics.rateLimitRejection.Inc(policy.Name)
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+		}
+
+		_, err := app.models.Usage.Increment(r.Context(), user.ID, user.Quota, 1)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrQuotaExceeded):
+				app.metrics.rateLimitRejection.Inc("daily-" + user.Quota.Name)
+				app.dailyQuotaExceededResponse(w, r, user.Quota)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requiredAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, err := r.Context().Value(contextUser("user")).(*data.User)
@@ -151,17 +325,26 @@ func (app *application) requiredActivatedUser(next http.Handler) http.Handler {
 	return app.requiredAuthenticatedUser(fn)
 }
 
+// requirePermission checks that the activated user holds permission before
+// counting the request against their quota.
 func (app *application) requirePermission(next http.Handler, permission string) http.Handler {
+	next = app.enforceQuota(next)
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, b := r.Context().Value(contextUser("user")).(*data.User)
 		if !b {
 			app.serverErrorResponse(w, r, errors.New("invalid context value"))
 			return
 		}
-		permissions, err := app.models.Permission.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		var permissions data.Permissions
+		if batch := batchFromContext(r.Context()); batch != nil {
+			permissions = batch.permissions
+		} else {
+			var err error
+			permissions, err = app.models.Permission.GetAllForUser(r.Context(), user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 		if !permissions.Include(permission) {
 			app.notPermittedResponse(w, r)
@@ -172,19 +355,29 @@ func (app *application) requirePermission(next http.Handler, permission string)
 	return app.requiredActivatedUser(fn)
 }
 
+// corsExposedHeaders are the response headers, beyond the CORS-safelisted
+// ones, that browser clients from a trusted origin may read.
+var corsExposedHeaders = strings.Join([]string{
+	"X-Request-ID", "Idempotent-Replayed", "Location",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+	"Deprecation", "Sunset", "Link", "API-Version",
+}, ", ")
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Vary", "Origin")
 		w.Header().Set("Vary", "Access-Control-Request-Method")
 		origin := r.Header.Get("Origin")
 		if origin != "" {
-			for i := range app.cfg.cors.trustedOrigins {
-				if origin == app.cfg.cors.trustedOrigins[i] {
+			trustedOrigins := app.config().CORS.TrustedOrigins
+			for i := range trustedOrigins {
+				if origin == trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID, Idempotency-Key, API-Version")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
@@ -195,15 +388,3 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-func (app *application) metrics(next http.Handler) http.Handler {
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		metrics := httpsnoop.CaptureMetrics(next, w, r)
-		app.cfg.metrics.totalRequestReceived.Add(1)
-		next.ServeHTTP(w, r)
-		app.cfg.metrics.totalResponsesSent.Add(1)
-		app.cfg.metrics.totalRequestsTime.Add(metrics.Duration.Microseconds())
-		app.cfg.metrics.totalResponseStatusMap.Add(strconv.Itoa(metrics.Code), 1)
-	})
-}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/ratelimit"
+)
+
+func TestRateLimitCountsRequestsRejectedByPermissionChecks(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.limiter = ratelimit.NewMemory()
+	cfg := app.config()
+	cfg.Limiter.Enabled = true
+	cfg.Limiter.Policies = ratelimit.Policies{
+		"admin": {Name: "admin", Limit: 2, Window: time.Minute, KeyBy: ratelimit.KeyByIP},
+	}
+	router := app.router()
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i, status := range want {
+		r := httptest.NewRequest(http.MethodGet, "/v1/admin/config", nil)
+		r = r.WithContext(context.WithValue(r.Context(), contextUser("user"), data.AnonymousUser))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("request %d: got status %d, want %d", i+1, w.Code, status)
+		}
+	}
+}
+
+func TestEnforceQuota(t *testing.T) {
+	user := &data.User{ID: 7, Activated: true, Quota: data.QuotaTier{Name: "free", RequestsPerMinute: 60, DailyLimit: 2}}
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		permissions []string
+		limited     bool
+		increment   error
+		counted     bool
+		want        int
+	}{
+		{"counted", http.MethodGet, "/v1/movies/1", []string{"movies:read"}, false, nil, true, http.StatusOK},
+		{"exceeded", http.MethodGet, "/v1/movies/1", []string{"movies:read"}, false, sql.ErrNoRows, true, http.StatusTooManyRequests},
+		{"not permitted", http.MethodGet, "/v1/movies/1", nil, false, nil, false, http.StatusForbidden},
+		{"rate limited by the route", http.MethodGet, "/v1/movies/1", nil, true, nil, false, http.StatusTooManyRequests},
+		{"not found", http.MethodGet, "/v1/nowhere", nil, false, nil, false, http.StatusNotFound},
+		{"method not allowed", http.MethodPost, "/v1/movies/1", nil, false, nil, false, http.StatusMethodNotAllowed},
+		{"usage is not counted", http.MethodGet, "/v1/users/me/usage", nil, false, nil, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			if tt.limited {
+				app.limiter = ratelimit.NewMemory()
+				cfg := app.config()
+				cfg.Limiter.Enabled = true
+				cfg.Limiter.Policies = ratelimit.Policies{
+					"movies": {Name: "movies", Limit: 0, Window: time.Minute, KeyBy: ratelimit.KeyByUser},
+				}
+			}
+			// The router's middleware does not run for unmatched requests.
+			if tt.want != http.StatusNotFound && tt.want != http.StatusMethodNotAllowed {
+				expectAuthentication(mock, user)
+			}
+			if tt.permissions != nil || tt.want == http.StatusForbidden {
+				rows := sqlmock.NewRows([]string{"code"})
+				for _, code := range tt.permissions {
+					rows.AddRow(code)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT p.code")).WithArgs(user.ID).WillReturnRows(rows)
+			}
+			if tt.counted {
+				exp := mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_usage")).WithArgs(user.ID, user.Quota.DailyLimit, 1)
+				if tt.increment != nil {
+					exp.WillReturnError(tt.increment)
+				} else {
+					exp.WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(1))
+				}
+			}
+			if tt.want == http.StatusOK {
+				switch tt.path {
+				case "/v1/movies/1":
+					mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(1)).
+						WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}).
+							AddRow(1, "Moana", 2016, 107, 1, time.Now(), "{animation}"))
+				case "/v1/users/me/usage":
+					mock.ExpectQuery(regexp.QuoteMeta("FROM user_usage")).WithArgs(user.ID).
+						WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(2))
+				}
+			}
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+testToken)
+			w := httptest.NewRecorder()
+			app.router().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEnableCORSExposesHeaders(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config().CORS.TrustedOrigins = []string{"https://example.com"}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	app.enableCORS(next).ServeHTTP(w, r)
+
+	exposed := map[string]bool{}
+	for _, h := range strings.Split(w.Header().Get("Access-Control-Expose-Headers"), ",") {
+		exposed[strings.TrimSpace(h)] = true
+	}
+	for _, h := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+		"Deprecation", "Sunset", "Link", "API-Version"} {
+		if !exposed[h] {
+			t.Errorf("%s is not exposed", h)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jersonsatoru/lets-go-further/internal/migrate"
+	"go.uber.org/zap"
+)
+
+// runMigrate implements `api migrate up|down [steps]|version`.
+func runMigrate(migrator *migrate.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [steps]|version")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		zap.S().Infow("applied migrations", "count", n, "latest", migrator.Latest())
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		n, err := migrator.Down(ctx, steps)
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		zap.S().Infow("rolled back migrations", "count", n)
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d\ndirty: %t\nlatest: %d\n", version, dirty, migrator.Latest())
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
+
+// checkSchema refuses to serve requests against a schema that is older than
+// the code, applying the pending migrations first when autoMigrate is set. A
+// newer schema is accepted so that a rollback of the binary keeps working.
+func checkSchema(migrator *migrate.Migrator, autoMigrate bool) error {
+	ctx := context.Background()
+	if autoMigrate {
+		n, err := migrator.Up(ctx)
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		if n > 0 {
+			zap.S().Infow("applied migrations", "count", n, "latest", migrator.Latest())
+		}
+	}
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return migrate.ErrDirty
+	}
+	if version < migrator.Latest() {
+		return fmt.Errorf("database schema is at version %d but %d is required, run `api migrate up`", version, migrator.Latest())
+	}
+	return nil
+}
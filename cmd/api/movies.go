@@ -1,16 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/patch"
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
 	"go.uber.org/zap"
 )
@@ -23,17 +27,17 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if id <= 0 {
-		zap.S().Errorw("error to decode json data", zap.Int("id", id))
+		app.logger(r.Context()).Errorw("error to decode json data", zap.Int("id", id))
 		app.notFoundErrorResponse(w, r)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(int64(id))
+	movie, err := app.movies(r).Get(r.Context(), int64(id))
 	log.Println(err)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			zap.S().Errorw("error to decode json data", zap.Int("id", id))
+			app.logger(r.Context()).Errorw("error to decode json data", zap.Int("id", id))
 			app.notFoundErrorResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -47,16 +51,16 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+type movieInput struct {
+	Title   string       `json:"title" validate:"required,minLength=1,maxLength=500"`
+	Year    int32        `json:"year" validate:"required,min=1888"`
+	Runtime data.Runtime `json:"runtime" validate:"required"`
+	Genres  []string     `json:"genres" validate:"required,minItems=1,maxItems=5,unique"`
+}
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}
-	err := app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	var input movieInput
+	if !app.bind(w, r, &input) {
 		return
 	}
 	v := validator.New()
@@ -73,7 +77,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Movies.Insert(movie)
+	err := app.movies(r).Insert(r.Context(), movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -94,7 +98,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.notFoundErrorResponse(w, r)
 		return
 	}
-	movie, err := app.models.Movies.Get(int64(id))
+	movie, err := app.movies(r).Get(r.Context(), int64(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -104,15 +108,8 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	input := struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}{}
-	err = json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	var input movieInput
+	if !app.bind(w, r, &input) {
 		return
 	}
 	movie.Year = input.Year
@@ -124,7 +121,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Movies.Update(movie)
+	err = app.movies(r).Update(r.Context(), movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -143,13 +140,13 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	_, err = app.models.Movies.Get(int64(id))
+	_, err = app.movies(r).Get(r.Context(), int64(id))
 	if err != nil {
 		app.notFoundErrorResponse(w, r)
 		return
 	}
 
-	err = app.models.Movies.Delete(int64(id))
+	err = app.movies(r).Delete(r.Context(), int64(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -166,6 +163,19 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// moviePatchDocument holds the movie fields a patch may change.
+type moviePatchDocument struct {
+	Title   string       `json:"title" validate:"nullable,minLength=1,maxLength=500"`
+	Year    int32        `json:"year" validate:"nullable,min=1888"`
+	Runtime data.Runtime `json:"runtime" validate:"nullable"`
+	Genres  []string     `json:"genres" validate:"nullable,minItems=1,maxItems=5,unique"`
+	Version int32        `json:"version" validate:"nullable"`
+}
+
+// partialUpdateMovieHandler applies a JSON Merge Patch (RFC 7396) or a JSON
+// Patch (RFC 6902) to the movie. A plain JSON body is treated as a merge
+// patch. Patching version to anything but the current one is an edit
+// conflict.
 func (app *application) partialUpdateMovieHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -173,7 +183,7 @@ func (app *application) partialUpdateMovieHandler(w http.ResponseWriter, r *http
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	movie, err := app.models.Movies.Get(int64(id))
+	movie, err := app.movies(r).Get(r.Context(), int64(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -183,35 +193,36 @@ func (app *application) partialUpdateMovieHandler(w http.ResponseWriter, r *http
 		}
 		return
 	}
-	input := struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}{}
-	err = json.NewDecoder(r.Body).Decode(&input)
+
+	doc, err := patchDocument(moviePatchDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+		Version: movie.Version,
+	})
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	var input moviePatchDocument
+	if !app.applyPatch(w, r, doc, &input) {
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	if input.Version != movie.Version {
+		app.editConflictResponse(w, r)
+		return
 	}
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
 	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Movies.Update(movie)
+	err = app.movies(r).Update(r.Context(), movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -228,6 +239,25 @@ func (app *application) partialUpdateMovieHandler(w http.ResponseWriter, r *http
 }
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := app.negotiateContentType(w, r, listMediaTypes...)
+	if !ok {
+		return
+	}
+	movies, metadata, ok := app.listMovies(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeRepresentation(w, http.StatusOK, mediaType, envelope{"metadata": metadata, "movies": movies}, func() table {
+		return movieTable(movies)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMovies reads the filters from the query string and returns the page of
+// movies they select. It writes the error response itself when it fails.
+func (app *application) listMovies(w http.ResponseWriter, r *http.Request) ([]*data.Movie, data.Metadata, bool) {
 	var input struct {
 		Title  string
 		Genres []string
@@ -243,16 +273,84 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
 	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
-		return
+		return nil, data.Metadata{}, false
 	}
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.movies(r).GetAll(r.Context(), input.Title, input.Genres, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
+		return nil, data.Metadata{}, false
+	}
+	return movies, metadata, true
+}
+
+func movieTable(movies []*data.Movie) table {
+	t := table{header: []string{"id", "title", "year", "runtime", "genres"}}
+	for _, m := range movies {
+		t.rows = append(t.rows, []string{
+			strconv.FormatInt(m.ID, 10),
+			m.Title,
+			strconv.Itoa(int(m.Year)),
+			strconv.Itoa(int(m.Runtime)),
+			strings.Join(m.Genres, ","),
+		})
+	}
+	return t
+}
+
+// patchDocument encodes v, the patch document of a resource, into the
+// generic values patches apply to.
+func patchDocument(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
 	}
+	var doc interface{}
+	err = json.Unmarshal(b, &doc)
+	return doc, err
+}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+// applyPatch applies the JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// in the body of r to doc, and decodes the result into dst as bind would. A
+// plain JSON body is treated as a merge patch. It writes the error response
+// itself when it fails.
+func (app *application) applyPatch(w http.ResponseWriter, r *http.Request, doc interface{}, dst interface{}) bool {
+	mediaTypes := []string{mediaTypeMergePatch, mediaTypeJSONPatch, mediaTypeJSON}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == mediaTypeJSONPatch {
+		var ops []patch.Operation
+		if !app.bind(w, r, &ops, mediaTypes...) {
+			return false
+		}
+		var err error
+		doc, err = patch.Apply(doc, ops)
+		if err != nil {
+			var opErr *patch.OperationError
+			switch {
+			case errors.Is(err, patch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r, err)
+			case errors.As(err, &opErr):
+				app.failedValidationResponse(w, r, map[string]string{fmt.Sprintf("patch[%d]", opErr.Index): opErr.Error()})
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return false
+		}
+	} else {
+		var mergePatch map[string]interface{}
+		if !app.bind(w, r, &mergePatch, mediaTypes...) {
+			return false
+		}
+		doc = patch.Merge(doc, mergePatch)
+	}
+
+	b, err := json.Marshal(doc)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if err := decodeJSON(bytes.NewReader(b), dst); err != nil {
+		app.bindErrorResponse(w, r, err, mediaTypes)
+		return false
 	}
+	return true
 }
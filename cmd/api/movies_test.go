@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestPartialUpdateMovie(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		update      error
+		updated     bool
+		want        int
+		code        string
+	}{
+		{"merge patch", mediaTypeMergePatch, `{"title":"Moana 2"}`, nil, true, http.StatusOK, ""},
+		{"merge patch with the current version", mediaTypeMergePatch, `{"title":"Moana 2","version":3}`, nil, true, http.StatusOK, ""},
+		{"merge patch with a stale version", mediaTypeMergePatch, `{"title":"Moana 2","version":2}`, nil, false, http.StatusConflict, "edit_conflict"},
+		{"merge patch null removes a field", mediaTypeMergePatch, `{"genres":null}`, nil, false, http.StatusUnprocessableEntity, "validation_failed"},
+		{"json patch", mediaTypeJSONPatch, `[{"op":"test","path":"/title","value":"Moana"},{"op":"add","path":"/genres/-","value":"music"}]`, nil, true, http.StatusOK, ""},
+		{"json patch test fails", mediaTypeJSONPatch, `[{"op":"test","path":"/title","value":"Frozen"}]`, nil, false, http.StatusConflict, "patch_test_failed"},
+		{"json patch index out of bounds", mediaTypeJSONPatch, `[{"op":"replace","path":"/genres/5","value":"music"}]`, nil, false, http.StatusUnprocessableEntity, "validation_failed"},
+		{"json patch replacing the version", mediaTypeJSONPatch, `[{"op":"replace","path":"/version","value":1}]`, nil, false, http.StatusConflict, "edit_conflict"},
+		{"concurrent update", mediaTypeMergePatch, `{"title":"Moana 2"}`, sql.ErrNoRows, true, http.StatusConflict, "edit_conflict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}).
+					AddRow(1, "Moana", 2016, 107, 3, time.Now(), "{animation}"))
+			if tt.updated {
+				exp := mock.ExpectQuery(regexp.QuoteMeta("UPDATE movies")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(1), int32(3))
+				if tt.update != nil {
+					exp.WillReturnError(tt.update)
+				} else {
+					exp.WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r = mux.SetURLVars(r, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+			app.partialUpdateMovieHandler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var res struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != tt.code {
+				t.Errorf("got code %q, want %q", res.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestPartialUpdateMovieV2(t *testing.T) {
+	app, mock := newTestApplication(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}).
+			AddRow(1, "Moana", 2016, 107, 3, time.Now(), "{animation}"))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE movies")).
+		WithArgs("Moana", int32(110), int32(2016), sqlmock.AnyArg(), int64(1), int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+
+	r := httptest.NewRequest(http.MethodPatch, "/v2/movies/1", strings.NewReader(`{"runtime_minutes":110,"version":3}`))
+	r.Header.Set("Content-Type", mediaTypeMergePatch)
+	r = mux.SetURLVars(r, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	app.partialUpdateMovieV2Handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var res struct {
+		Movie movieV2 `json:"movie"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Movie.RuntimeMinutes != 110 || res.Movie.Version != 4 {
+		t.Errorf("got %+v, want 110 minutes at version 4", res.Movie)
+	}
+}
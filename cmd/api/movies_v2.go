@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/validator"
+)
+
+// movieV2 is the v2 representation of a movie. Unlike v1 it carries the
+// runtime as a number of minutes and the creation time.
+type movieV2 struct {
+	ID             int64     `json:"id"`
+	Title          string    `json:"title"`
+	Year           int32     `json:"year"`
+	RuntimeMinutes int32     `json:"runtime_minutes"`
+	Genres         []string  `json:"genres"`
+	Version        int32     `json:"version"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func toMovieV2(m *data.Movie) movieV2 {
+	return movieV2{
+		ID:             m.ID,
+		Title:          m.Title,
+		Year:           m.Year,
+		RuntimeMinutes: int32(m.Runtime),
+		Genres:         m.Genres,
+		Version:        m.Version,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+type movieInputV2 struct {
+	Title          string   `json:"title" validate:"required,minLength=1,maxLength=500"`
+	Year           int32    `json:"year" validate:"required,min=1888"`
+	RuntimeMinutes int32    `json:"runtime_minutes" validate:"required,min=1"`
+	Genres         []string `json:"genres" validate:"required,minItems=1,maxItems=5,unique"`
+}
+
+func (in movieInputV2) apply(movie *data.Movie) {
+	movie.Title = in.Title
+	movie.Year = in.Year
+	movie.Runtime = data.Runtime(in.RuntimeMinutes)
+	movie.Genres = in.Genres
+}
+
+// validateMovieV2 reports the errors of data.ValidateMovie under the v2 field
+// names.
+func validateMovieV2(movie *data.Movie) map[string]string {
+	v := validator.New()
+	if data.ValidateMovie(v, movie); v.Valid() {
+		return nil
+	}
+	if reason, ok := v.Errors["runtime"]; ok {
+		delete(v.Errors, "runtime")
+		v.Errors["runtime_minutes"] = reason
+	}
+	return v.Errors
+}
+
+func (app *application) listMoviesV2Handler(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := app.negotiateContentType(w, r, listMediaTypes...)
+	if !ok {
+		return
+	}
+	movies, metadata, ok := app.listMovies(w, r)
+	if !ok {
+		return
+	}
+	out := make([]movieV2, len(movies))
+	for i, m := range movies {
+		out[i] = toMovieV2(m)
+	}
+	err := app.writeRepresentation(w, http.StatusOK, mediaType, envelope{"metadata": metadata, "movies": out}, func() table {
+		return movieTable(movies)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieV2Handler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.movieFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"movie": toMovieV2(movie)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMovieV2Handler(w http.ResponseWriter, r *http.Request) {
+	var input movieInputV2
+	if !app.bind(w, r, &input) {
+		return
+	}
+	movie := &data.Movie{}
+	input.apply(movie)
+	if errs := validateMovieV2(movie); errs != nil {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+	err := app.movies(r).Insert(r.Context(), movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	header := make(http.Header)
+	header.Set("Location", fmt.Sprintf("/v2/movies/%d", movie.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": toMovieV2(movie)}, header)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMovieV2Handler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.movieFromPath(w, r)
+	if !ok {
+		return
+	}
+	var input movieInputV2
+	if !app.bind(w, r, &input) {
+		return
+	}
+	input.apply(movie)
+	if errs := validateMovieV2(movie); errs != nil {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+	err := app.movies(r).Update(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": toMovieV2(movie)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moviePatchDocumentV2 holds the movie fields a v2 patch may change.
+type moviePatchDocumentV2 struct {
+	Title          string   `json:"title" validate:"nullable,minLength=1,maxLength=500"`
+	Year           int32    `json:"year" validate:"nullable,min=1888"`
+	RuntimeMinutes int32    `json:"runtime_minutes" validate:"nullable"`
+	Genres         []string `json:"genres" validate:"nullable,minItems=1,maxItems=5,unique"`
+	Version        int32    `json:"version" validate:"nullable"`
+}
+
+// partialUpdateMovieV2Handler patches the v2 representation of the movie like
+// partialUpdateMovieHandler does the v1 one.
+func (app *application) partialUpdateMovieV2Handler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.movieFromPath(w, r)
+	if !ok {
+		return
+	}
+	doc, err := patchDocument(moviePatchDocumentV2{
+		Title:          movie.Title,
+		Year:           movie.Year,
+		RuntimeMinutes: int32(movie.Runtime),
+		Genres:         movie.Genres,
+		Version:        movie.Version,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var input moviePatchDocumentV2
+	if !app.applyPatch(w, r, doc, &input) {
+		return
+	}
+	if input.Version != movie.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	movieInputV2{
+		Title:          input.Title,
+		Year:           input.Year,
+		RuntimeMinutes: input.RuntimeMinutes,
+		Genres:         input.Genres,
+	}.apply(movie)
+	if errs := validateMovieV2(movie); errs != nil {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+	err = app.movies(r).Update(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": toMovieV2(movie)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieFromPath loads the movie named by the id path variable. It writes the
+// error response itself when it fails.
+func (app *application) movieFromPath(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		app.notFoundErrorResponse(w, r)
+		return nil, false
+	}
+	movie, err := app.movies(r).Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return movie, true
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	mediaTypeJSON    = "application/json"
+	mediaTypeMsgPack = "application/msgpack"
+	mediaTypeCSV     = "text/csv"
+
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// listMediaTypes are the representations offered by list endpoints, in order
+// of preference.
+var listMediaTypes = []string{mediaTypeJSON, mediaTypeMsgPack, mediaTypeCSV}
+
+// table is the CSV representation of a list response.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityValues parses a header such as Accept or Accept-Encoding into
+// its values and their weights. Parameters other than q are ignored.
+func parseQualityValues(header string) []qualityValue {
+	var values []qualityValue
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		qv := qualityValue{value: value, q: 1}
+		for _, param := range params[1:] {
+			name, v, _ := cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(name) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			qv.q = q
+		}
+		values = append(values, qv)
+	}
+	return values
+}
+
+// negotiate picks the offer with the highest weight in header. Each offer is
+// weighted by the most specific value matching it, as scored by match, and
+// ties go to the earlier offer. It returns "" when no offer is acceptable.
+func negotiate(header string, offers []string, match func(value, offer string) int) string {
+	values := parseQualityValues(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, 0
+		for _, v := range values {
+			if s := match(v.value, offer); s > specificity {
+				q, specificity = v.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func matchMediaType(value, offer string) int {
+	switch {
+	case value == offer:
+		return 3
+	case value == "*/*":
+		return 1
+	case strings.HasSuffix(value, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(value, "*")):
+		return 2
+	}
+	return 0
+}
+
+func matchEncoding(value, offer string) int {
+	switch value {
+	case offer:
+		return 2
+	case "*":
+		return 1
+	}
+	return 0
+}
+
+// negotiateContentType chooses the representation to send based on the
+// Accept header. When none of offers is acceptable it sends 406 Not
+// Acceptable and returns false.
+func (app *application) negotiateContentType(w http.ResponseWriter, r *http.Request, offers ...string) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0], true
+	}
+	mediaType := negotiate(accept, offers, matchMediaType)
+	if mediaType == "" {
+		app.notAcceptableResponse(w, r, offers)
+		return "", false
+	}
+	return mediaType, true
+}
+
+// acceptJSON guards the routes that only have a JSON representation, sending
+// 406 Not Acceptable to requests that do not accept it.
+func (app *application) acceptJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.negotiateContentType(w, r, mediaTypeJSON); !ok {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRepresentation writes data in the negotiated mediaType. t is only built
+// for CSV, which has no room for anything but the rows.
+func (app *application) writeRepresentation(
+	w http.ResponseWriter, status int, mediaType string, data envelope, t func() table) error {
+	switch mediaType {
+	case mediaTypeMsgPack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		enc.SetSortMapKeys(true)
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", mediaTypeMsgPack)
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+		return nil
+	case mediaTypeCSV:
+		tbl := t()
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.Write(tbl.header)
+		for _, row := range tbl.rows {
+			cw.Write(escapeFormulas(row))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+		return nil
+	}
+	return app.writeJSON(w, status, data, nil)
+}
+
+// escapeFormulas prefixes the cells that a spreadsheet would evaluate as a
+// formula with a quote, so that user data opened from a CSV export is shown
+// as text rather than run.
+func escapeFormulas(row []string) []string {
+	out := make([]string, len(row))
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cell = "'" + cell
+		}
+		out[i] = cell
+	}
+	return out
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestParseQualityValues(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []qualityValue
+	}{
+		{"", nil},
+		{"application/json", []qualityValue{{"application/json", 1}}},
+		{"Text/CSV;q=0.5, */*;q=0.1", []qualityValue{{"text/csv", 0.5}, {"*/*", 0.1}}},
+		{"gzip;level=9;q=0.8", []qualityValue{{"gzip", 0.8}}},
+		{"br;Q=0", []qualityValue{{"br", 0}}},
+		{"gzip;q=2, br;q=abc", []qualityValue{{"gzip", 0}, {"br", 0}}},
+		{" , gzip ,", []qualityValue{{"gzip", 1}}},
+	}
+	for _, tt := range tests {
+		if got := parseQualityValues(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQualityValues(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"text/csv", mediaTypeCSV},
+		{"text/*", mediaTypeCSV},
+		{"*/*", mediaTypeJSON},
+		{"application/msgpack, application/json", mediaTypeJSON},
+		{"application/json;q=0.5, application/msgpack", mediaTypeMsgPack},
+		{"*/*, application/json;q=0", mediaTypeMsgPack},
+		{"text/html", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.header, listMediaTypes, matchMediaType); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestJSONOnlyRoutesRejectOtherRepresentations(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   int
+	}{
+		{"text/csv", http.StatusNotAcceptable},
+		{"application/json", http.StatusOK},
+		{"", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			user := &data.User{ID: 3, Activated: true, Quota: data.QuotaTier{Name: "free"}}
+			expectAuthentication(mock, user)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT p.code")).WithArgs(user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("movies:read"))
+			expectUsage(mock, user, 1)
+			if tt.want == http.StatusOK {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM movies")).WithArgs(int64(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "runtime", "version", "created_at", "genres"}).
+						AddRow(1, "Moana", 2016, 107, 1, time.Now(), "{animation}"))
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			r.Header.Set("Authorization", "Bearer "+testToken)
+			w := httptest.NewRecorder()
+			app.router().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCSVCellsAreNotFormulas(t *testing.T) {
+	app, _ := newTestApplication(t)
+	w := httptest.NewRecorder()
+	err := app.writeRepresentation(w, http.StatusOK, mediaTypeCSV, nil, func() table {
+		return table{
+			header: []string{"id", "title"},
+			rows: [][]string{
+				{"1", "=HYPERLINK(\"http://evil.test\")"},
+				{"2", "+1"},
+				{"3", "-2+3"},
+				{"4", "@SUM(A1)"},
+				{"5", "Moana"},
+			},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,title\n" +
+		"1,\"'=HYPERLINK(\"\"http://evil.test\"\")\"\n" +
+		"2,'+1\n" +
+		"3,'-2+3\n" +
+		"4,'@SUM(A1)\n" +
+		"5,Moana\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
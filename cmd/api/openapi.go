@@ -0,0 +1,305 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/health"
+	"github.com/jersonsatoru/lets-go-further/internal/mailer"
+	"github.com/jersonsatoru/lets-go-further/internal/openapi"
+	"github.com/jersonsatoru/lets-go-further/internal/patch"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+const (
+	authBearer  = "bearer"
+	authWebhook = "webhook"
+)
+
+// routeDoc describes an operation registered in routes. Every route must have
+// one, see openapi_test.go.
+type routeDoc struct {
+	method     string
+	path       string
+	summary    string
+	tag        string
+	auth       string
+	permission string
+	query      []openapi.Parameter
+	request    interface{}
+	// bodies replaces request for operations accepting several media types.
+	bodies   map[string]interface{}
+	status   int
+	response interface{}
+	// responseType is the media type of the success response when it is not
+	// application/json.
+	responseType string
+	// deprecated marks v1 operations replaced in v2.
+	deprecated bool
+	// idempotent operations accept an Idempotency-Key header.
+	idempotent bool
+}
+
+type problemDocument struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail"`
+	Instance      string         `json:"instance"`
+	Code          string         `json:"code"`
+	RequestID     string         `json:"request_id"`
+	InvalidParams []invalidParam `json:"invalid-params,omitempty"`
+}
+
+var moviesQuery = []openapi.Parameter{
+	{Name: "title", In: "query", Description: "Full text search on the title", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "genres", In: "query", Description: "Comma separated genres the movies must all have", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "page", In: "query", Schema: &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(10_000_000)}},
+	{Name: "page_size", In: "query", Schema: &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(100)}},
+	{Name: "sort", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}}},
+}
+
+var idempotencyKeyHeader = openapi.Parameter{
+	Name: "Idempotency-Key", In: "header",
+	Description: "Unique key of the request. Retries with the same key replay the first response, marked with Idempotent-Replayed.",
+	Schema:      &openapi.Schema{Type: "string", MaxLength: integer(maxIdempotencyKeyLength)},
+}
+
+var routeDocs = []routeDoc{
+	{method: http.MethodGet, path: "/v1/healthcheck", summary: "Show the service status and version", tag: "health",
+		status: http.StatusOK, response: struct {
+			Port       int    `json:"port"`
+			Env        string `json:"env"`
+			APIVersion string `json:"apiVersion"`
+			Status     string `json:"status"`
+		}{}},
+	{method: http.MethodGet, path: "/v1/health/live", summary: "Liveness probe", tag: "health",
+		status: http.StatusOK, response: struct {
+			Status string `json:"status"`
+		}{}},
+	{method: http.MethodGet, path: "/v1/health/ready", summary: "Readiness probe, failing with 503 when a dependency is unhealthy", tag: "health",
+		status: http.StatusOK, response: health.Report{}},
+
+	{method: http.MethodGet, path: "/v1/movies", summary: "List movies", tag: "movies", auth: authBearer, permission: "movies:read", deprecated: true,
+		query: moviesQuery, status: http.StatusOK, response: struct {
+			Metadata data.Metadata `json:"metadata"`
+			Movies   []data.Movie  `json:"movies"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/movies", summary: "Create a movie", tag: "movies", auth: authBearer, permission: "movies:write", deprecated: true, idempotent: true,
+		request: movieInput{}, status: http.StatusCreated, response: movieResponse{}},
+	{method: http.MethodGet, path: "/v1/movies/{id:[0-9]+}", summary: "Show a movie", tag: "movies", auth: authBearer, permission: "movies:read", deprecated: true,
+		status: http.StatusOK, response: movieResponse{}},
+	{method: http.MethodPut, path: "/v1/movies/{id:[0-9]+}", summary: "Replace a movie", tag: "movies", auth: authBearer, permission: "movies:write", deprecated: true,
+		request: movieInput{}, status: http.StatusOK, response: movieResponse{}},
+	{method: http.MethodPatch, path: "/v1/movies/{id:[0-9]+}", summary: "Update a movie with a merge patch or a JSON patch", tag: "movies", auth: authBearer, permission: "movies:write", deprecated: true,
+		bodies: map[string]interface{}{
+			mediaTypeMergePatch: moviePatchDocument{},
+			mediaTypeJSONPatch:  []patch.Operation{},
+			mediaTypeJSON:       moviePatchDocument{},
+		},
+		status: http.StatusOK, response: movieResponse{}},
+	{method: http.MethodDelete, path: "/v1/movies/{id:[0-9]+}", summary: "Delete a movie", tag: "movies", auth: authBearer, permission: "movies:write", deprecated: true,
+		status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/v2/movies", summary: "List movies", tag: "movies", auth: authBearer, permission: "movies:read",
+		query: moviesQuery, status: http.StatusOK, response: struct {
+			Metadata data.Metadata `json:"metadata"`
+			Movies   []movieV2     `json:"movies"`
+		}{}},
+	{method: http.MethodPost, path: "/v2/movies", summary: "Create a movie", tag: "movies", auth: authBearer, permission: "movies:write", idempotent: true,
+		request: movieInputV2{}, status: http.StatusCreated, response: movieV2Response{}},
+	{method: http.MethodGet, path: "/v2/movies/{id:[0-9]+}", summary: "Show a movie", tag: "movies", auth: authBearer, permission: "movies:read",
+		status: http.StatusOK, response: movieV2Response{}},
+	{method: http.MethodPut, path: "/v2/movies/{id:[0-9]+}", summary: "Replace a movie", tag: "movies", auth: authBearer, permission: "movies:write",
+		request: movieInputV2{}, status: http.StatusOK, response: movieV2Response{}},
+	{method: http.MethodPatch, path: "/v2/movies/{id:[0-9]+}", summary: "Update a movie with a merge patch or a JSON patch", tag: "movies", auth: authBearer, permission: "movies:write",
+		bodies: map[string]interface{}{
+			mediaTypeMergePatch: moviePatchDocumentV2{},
+			mediaTypeJSONPatch:  []patch.Operation{},
+			mediaTypeJSON:       moviePatchDocumentV2{},
+		},
+		status: http.StatusOK, response: movieV2Response{}},
+	{method: http.MethodDelete, path: "/v2/movies/{id:[0-9]+}", summary: "Delete a movie", tag: "movies", auth: authBearer, permission: "movies:write",
+		status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/v1/users", summary: "Register a user", tag: "users", idempotent: true,
+		request: registerUserInput{}, status: http.StatusCreated, response: userResponse{}},
+	{method: http.MethodPut, path: "/v1/users/activated", summary: "Activate a user with the token sent by email", tag: "users",
+		request: activateUserInput{}, status: http.StatusOK, response: data.User{}},
+	{method: http.MethodGet, path: "/v1/users/me/usage", summary: "Show the quota usage of the authenticated user", tag: "users", auth: authBearer,
+		status: http.StatusOK, response: struct {
+			Usage data.Usage `json:"usage"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/tokens/authentication", summary: "Create an authentication token", tag: "tokens",
+		request: authenticationTokenInput{}, status: http.StatusCreated, response: data.Token{}},
+
+	{method: http.MethodGet, path: "/v1/admin/mailer/templates", summary: "List the email templates", tag: "admin", auth: authBearer, permission: "mailer:admin",
+		status: http.StatusOK, response: struct {
+			Templates []mailer.Template `json:"templates"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/admin/mailer/templates/{name:[a-z0-9_]+\\.tmpl}/preview", summary: "Render an email template", tag: "admin", auth: authBearer, permission: "mailer:admin",
+		request: previewTemplateInput{}, status: http.StatusOK, response: struct {
+			Email struct {
+				Locale    string `json:"locale"`
+				Subject   string `json:"subject"`
+				Plaintext string `json:"plaintext"`
+				HTMLBody  string `json:"htmlBody"`
+			} `json:"email"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/admin/mailer/templates/{name:[a-z0-9_]+\\.tmpl}/send", summary: "Send an email template to a test recipient", tag: "admin", auth: authBearer, permission: "mailer:admin",
+		request: sendTestTemplateInput{}, status: http.StatusOK, response: struct {
+			Message string `json:"message"`
+			EmailID int64  `json:"email_id"`
+		}{}},
+	{method: http.MethodGet, path: "/v1/admin/config", summary: "Show the running configuration with secrets redacted", tag: "admin", auth: authBearer, permission: "config:admin",
+		status: http.StatusOK, response: "", responseType: "application/yaml"},
+	{method: http.MethodPost, path: "/v1/admin/config/reload", summary: "Reload the configuration file", tag: "admin", auth: authBearer, permission: "config:admin",
+		status: http.StatusOK, response: struct {
+			Changed []string `json:"changed"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/mailer/events", summary: "Receive bounce and complaint events from the mail provider", tag: "mailer", auth: authWebhook,
+		request: mailerEventInput{}, status: http.StatusAccepted, response: struct {
+			Message string `json:"message"`
+		}{}},
+	{method: http.MethodPost, path: "/v1/batch", summary: "Run several operations in one request, optionally movie writes in one transaction", tag: "batch",
+		request: batchInput{}, status: http.StatusOK, response: struct {
+			Committed *bool         `json:"committed,omitempty"`
+			Results   []batchResult `json:"results"`
+		}{}},
+
+	{method: http.MethodGet, path: "/v1/metrics", summary: "Expose expvar metrics", tag: "metrics", auth: authBearer, permission: "metrics:read",
+		status: http.StatusOK, response: map[string]interface{}{}},
+	{method: http.MethodGet, path: "/v1/metrics/prometheus", summary: "Expose metrics in the Prometheus text format", tag: "metrics", auth: authBearer, permission: "metrics:read",
+		status: http.StatusOK, response: "", responseType: "text/plain"},
+	{method: http.MethodGet, path: "/v1/openapi.json", summary: "Show this OpenAPI document", tag: "meta",
+		status: http.StatusOK, response: map[string]interface{}{}},
+	{method: http.MethodGet, path: "/v1/docs", summary: "Browse the API documentation, when enabled", tag: "meta",
+		status: http.StatusOK, response: "", responseType: "text/html"},
+}
+
+type movieResponse struct {
+	Movie data.Movie `json:"movie"`
+}
+
+type movieV2Response struct {
+	Movie movieV2 `json:"movie"`
+}
+
+type userResponse struct {
+	User data.User `json:"user"`
+}
+
+// newOpenAPIDocument builds the OpenAPI document from routeDocs.
+func newOpenAPIDocument() *openapi.Document {
+	g := openapi.NewGenerator()
+	g.Override(data.Runtime(0), openapi.Schema{Type: "string", Pattern: "^[0-9]+ mins$", Example: "102 mins"})
+	g.Schemas["Problem"] = g.Schema(problemDocument{})
+	problem := map[string]openapi.MediaType{"application/problem+json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Problem"}}}
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Greenlight API",
+			Version: version,
+			Description: "Errors are RFC 7807 problem documents. Clients may also authenticate with a TLS client " +
+				"certificate mapped to their user.",
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Components: openapi.Components{
+			Schemas: g.Schemas,
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				authBearer:  {Type: "http", Scheme: "bearer", Description: "Token created with POST /v1/tokens/authentication"},
+				authWebhook: {Type: "apiKey", In: "header", Name: "X-Webhook-Secret", Description: "Shared secret configured with the mail provider"},
+			},
+		},
+	}
+	for _, rd := range routeDocs {
+		path, params := openapi.PathFromTemplate(rd.path)
+		op := &openapi.Operation{
+			OperationID: operationID(rd.method, path),
+			Summary:     rd.summary,
+			Tags:        []string{rd.tag},
+			Parameters:  append(params, rd.query...),
+			Deprecated:  rd.deprecated,
+			Permission:  rd.permission,
+			Responses: map[string]openapi.Response{
+				"default": {Description: "Problem", Content: problem},
+			},
+		}
+		if rd.idempotent {
+			op.Parameters = append(op.Parameters, idempotencyKeyHeader)
+		}
+		if rd.auth != "" {
+			op.Security = []map[string][]string{{rd.auth: {}}}
+		}
+		bodies := rd.bodies
+		if rd.request != nil {
+			bodies = map[string]interface{}{mediaTypeJSON: rd.request}
+		}
+		if bodies != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: make(map[string]openapi.MediaType)}
+			for mediaType, body := range bodies {
+				op.RequestBody.Content[mediaType] = openapi.MediaType{Schema: g.Schema(body)}
+			}
+		}
+		success := openapi.Response{Description: http.StatusText(rd.status)}
+		if rd.response != nil {
+			responseType := rd.responseType
+			if responseType == "" {
+				responseType = mediaTypeJSON
+			}
+			success.Content = map[string]openapi.MediaType{responseType: {Schema: g.Schema(rd.response)}}
+		}
+		op.Responses[fmt.Sprint(rd.status)] = success
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(openapi.PathItem)
+		}
+		doc.Paths[path][strings.ToLower(rd.method)] = op
+	}
+	return doc
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func integer(n int) *int {
+	return &n
+}
+
+// operationID derives a stable identifier such as getV1MoviesId.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.' || r == '_'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(app.openapi)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config().OpenAPI.DocsUI {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsHTML)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/openapi"
+)
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	app := &application{metrics: sharedTestMetrics()}
+	doc := newOpenAPIDocument()
+
+	served := make(map[string]bool)
+	err := app.router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		path, _ := openapi.PathFromTemplate(template)
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			served[method+" "+path] = true
+			if doc.Paths[path].Operation(method) == nil {
+				t.Errorf("%s %s is registered but missing from the OpenAPI document", method, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stale []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if op := strings.ToUpper(method) + " " + path; !served[op] {
+				stale = append(stale, op)
+			}
+		}
+	}
+	sort.Strings(stale)
+	for _, op := range stale {
+		t.Errorf("%s is described in the OpenAPI document but not registered", op)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 10
+)
+
+// outboxSink delivers an entry. tx is bound to the transaction of the batch,
+// sinks must use it rather than app.models for their own queries.
+type outboxSink func(ctx context.Context, tx data.Models, entry *data.OutboxEntry) error
+
+func (app *application) outboxSinks() map[string]outboxSink {
+	return map[string]outboxSink{
+		data.TopicEmail:          app.emailSink,
+		data.TopicUserRegistered: app.logEventSink,
+	}
+}
+
+// startOutboxRelay polls the outbox until ctx is done. A batch in progress is
+// allowed to finish unless abort is cancelled too, in which case its
+// transaction is rolled back and its entries are retried later.
+func (app *application) startOutboxRelay(ctx, abort context.Context) {
+	app.background("outbox relay", func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.relayOutbox(ctx, abort)
+			}
+		}
+	})
+}
+
+// relayOutbox delivers batches until the outbox is drained, then records how
+// many emails are left pending so that scraping the metrics never queries the
+// database.
+func (app *application) relayOutbox(ctx, abort context.Context) {
+	defer app.updateMailQueueDepth(ctx)
+	for ctx.Err() == nil {
+		n, err := app.relayOutboxBatch(abort)
+		if err != nil {
+			app.logger(ctx).Errorw("outbox relay failed", "error", err.Error())
+			return
+		}
+		if n < outboxBatchSize {
+			return
+		}
+	}
+}
+
+func (app *application) updateMailQueueDepth(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	n, err := app.models.Outbox.CountPending(ctx, data.TopicEmail)
+	if err != nil {
+		app.logger(ctx).Errorw("counting pending emails failed", "error", err.Error())
+		return
+	}
+	app.metrics.mailQueueDepth.Set(float64(n))
+}
+
+// relayOutboxBatch delivers a batch of entries while holding their row locks,
+// and records the outcome in the same transaction. The batch is not bound to
+// the relay context so that a graceful shutdown never rolls back entries that
+// were already handed to a sink; only abort does.
+//
+// Delivery is at least once, not exactly once: an entry handed to a sink is
+// delivered again when the transaction fails to commit or abort rolls it
+// back, so sinks must tolerate duplicates.
+func (app *application) relayOutboxBatch(abort context.Context) (int, error) {
+	var n int
+	ctx, span := tracing.Start(abort, "outbox.relayBatch")
+	defer span.End()
+	err := app.models.Transaction(ctx, func(tx data.Models) error {
+		entries, err := tx.Outbox.GetPending(ctx, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		n = len(entries)
+		for _, entry := range entries {
+			err = app.deliverOutboxEntry(ctx, tx, entry)
+			if err != nil {
+				app.logger(ctx).Errorw(err.Error(), "outboxID", entry.ID, "topic", entry.Topic, "attempts", entry.Attempts+1)
+				retryAfter := time.Duration(1<<entry.Attempts) * time.Minute
+				if err = tx.Outbox.MarkFailed(ctx, entry.ID, err, retryAfter); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = tx.Outbox.MarkProcessed(ctx, entry.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	span.SetAttributes(tracing.Int("outbox.batch_size", n))
+	span.RecordError(err)
+	return n, err
+}
+
+func (app *application) deliverOutboxEntry(ctx context.Context, tx data.Models, entry *data.OutboxEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	sink, ok := app.outboxSinks()[entry.Topic]
+	if !ok {
+		return fmt.Errorf("no sink registered for topic %q", entry.Topic)
+	}
+	ctx, span := tracing.Start(ctx, "outbox.deliver",
+		tracing.String("outbox.topic", entry.Topic),
+		tracing.Int("outbox.id", int(entry.ID)))
+	defer span.End()
+	err = sink(ctx, tx, entry)
+	span.RecordError(err)
+	return err
+}
+
+func (app *application) emailSink(ctx context.Context, tx data.Models, entry *data.OutboxEntry) error {
+	var msg data.EmailMessage
+	err := json.Unmarshal(entry.Payload, &msg)
+	if err != nil {
+		return err
+	}
+	err = app.sendEmail(ctx, tx, &msg)
+	if errors.Is(err, errEmailSuppressed) {
+		app.logger(ctx).Infow(err.Error(), "outboxID", entry.ID, "emailID", msg.EmailID)
+		return nil
+	}
+	return err
+}
+
+func (app *application) logEventSink(ctx context.Context, tx data.Models, entry *data.OutboxEntry) error {
+	app.logger(ctx).Infow("domain event",
+		"outboxID", entry.ID,
+		"topic", entry.Topic,
+		"payload", string(entry.Payload))
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/mailer"
+)
+
+var outboxColumns = []string{"id", "created_at", "topic", "payload", "attempts", "available_at", "last_error"}
+
+func TestRelayOutboxBatch(t *testing.T) {
+	app, mock := newTestApplication(t)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox")).
+		WithArgs(data.OutboxMaxAttempts, outboxBatchSize).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, now, data.TopicUserRegistered, []byte(`{"user":{"id":1}}`), 0, now, "").
+			AddRow(2, now, "unknown", []byte(`{}`), 2, now, ""))
+	mock.ExpectExec(regexp.QuoteMeta("SET processed_at = NOW()")).
+		WithArgs(1, data.TopicEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1, last_error = $2")).
+		WithArgs(2, `no sink registered for topic "unknown"`, 240, data.TopicEmail, data.OutboxMaxAttempts).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := app.relayOutboxBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("relayed %d entries, want 2", n)
+	}
+}
+
+func TestRelayOutboxBatchRollsBackWhenMarkingFails(t *testing.T) {
+	app, mock := newTestApplication(t)
+	now := time.Now()
+	markErr := errors.New("connection reset")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox")).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, now, data.TopicUserRegistered, []byte(`{}`), 0, now, ""))
+	mock.ExpectExec(regexp.QuoteMeta("SET processed_at = NOW()")).WillReturnError(markErr)
+	mock.ExpectRollback()
+
+	_, err := app.relayOutboxBatch(context.Background())
+	if !errors.Is(err, markErr) {
+		t.Fatalf("got error %v, want %v", err, markErr)
+	}
+}
+
+func TestOutboxDropsEmailTemplateData(t *testing.T) {
+	app, mock := newTestApplication(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("payload = CASE WHEN topic = $2 THEN payload - 'data' ELSE payload END")).
+		WithArgs(1, data.TopicEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("payload = CASE WHEN topic = $4 AND attempts + 1 >= $5 THEN payload - 'data' ELSE payload END")).
+		WithArgs(2, "timeout", 60, data.TopicEmail, data.OutboxMaxAttempts).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := app.models.Outbox.MarkProcessed(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Outbox.MarkFailed(context.Background(), 2, errors.New("timeout"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelayOutboxBatchSendsEmailsWithinTheTransaction(t *testing.T) {
+	app, mock := newTestApplication(t)
+	now := time.Now()
+	payload := []byte(`{"email_id":7,"recipient":"alice@example.com","locale":"pt-BR","template":"user_welcome.tmpl",` +
+		`"data":{"userID":42,"activationToken":"Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"}}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox")).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, now, data.TopicEmail, payload, 0, now, ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM email_suppressions")).
+		WithArgs("alice@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	// The email was sent, failing to record it must not get it sent again.
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE emails")).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec(regexp.QuoteMeta("SET processed_at = NOW()")).
+		WithArgs(1, data.TopicEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := app.relayOutboxBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := app.mailer.(*mailer.MemoryMailer).Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(messages))
+	}
+	if messages[0].Locale != "pt-BR" {
+		t.Errorf("sent the %s email, want pt-BR", messages[0].Locale)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jersonsatoru/lets-go-further/internal/config"
+	"go.uber.org/zap"
+)
+
+// restartRequiredError lists the settings that changed but can only be
+// applied by restarting the server.
+type restartRequiredError struct {
+	fields []string
+}
+
+func (e *restartRequiredError) Error() string {
+	return "changes require a restart: " + strings.Join(e.fields, ", ")
+}
+
+// config returns the configuration currently in effect. Callers should read
+// it once per request, since a reload may swap it at any time.
+func (app *application) config() *config.Config {
+	return app.cfg.Load().(*config.Config)
+}
+
+// reloadConfig reads the config file again and applies the result as a whole,
+// or not at all when any setting that needs a restart has changed. It returns
+// the settings that were changed. Only the file can bring changes: the
+// environment of a running process cannot be changed from outside, and the
+// flags were parsed once.
+func (app *application) reloadConfig() ([]string, error) {
+	app.reloadMu.Lock()
+	defer app.reloadMu.Unlock()
+
+	next, err := app.loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	changed, restart := app.config().Diff(next)
+	if len(restart) > 0 {
+		return nil, &restartRequiredError{fields: restart}
+	}
+	app.cfg.Store(next)
+	logLevel.SetLevel(next.Log.Level)
+	return changed, nil
+}
+
+// notifySIGHUP starts catching SIGHUP, whose default action would kill the
+// process. main calls it before the slow startup steps; a signal received
+// until reloadOnSIGHUP runs is kept and handled then.
+func notifySIGHUP() chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch
+}
+
+// reloadOnSIGHUP reloads the configuration every time the process receives
+// SIGHUP until stop is closed.
+func (app *application) reloadOnSIGHUP(stop <-chan struct{}) {
+	ch := app.sighup
+	if ch == nil {
+		return
+	}
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				changed, err := app.reloadConfig()
+				if err != nil {
+					zap.S().Errorw("config reload failed", "error", err.Error())
+					continue
+				}
+				zap.S().Infow("config reloaded", "changed", changed)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (app *application) showConfigHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := app.config().Dump()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(b)
+}
+
+func (app *application) reloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := app.reloadConfig()
+	if err != nil {
+		var restartErr *restartRequiredError
+		var invalid config.Errors
+		switch {
+		case errors.As(err, &restartErr):
+			app.errorResponse(w, r, http.StatusConflict, "restart_required", restartErr.Error(), envelope{"fields": restartErr.fields})
+		case errors.As(err, &invalid):
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, "invalid_configuration", "the new configuration is invalid", envelope{"errors": []string(invalid)})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+	app.logger(r.Context()).Infow("config reloaded", "changed", changed)
+	err = app.writeJSON(w, http.StatusOK, envelope{"changed": changed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
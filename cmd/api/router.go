@@ -7,23 +7,51 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func (app *application) routes() *mux.Router {
+func (app *application) routes() http.Handler {
+	app.dispatch = app.selectVersion(app.instrument(app.router()))
+	return app.requestID(app.dispatch)
+}
+
+// router registers every route. Each one must be described in routeDocs.
+func (app *application) router() *mux.Router {
 	r := mux.NewRouter()
 	r.NotFoundHandler = http.HandlerFunc(app.notFoundErrorResponse)
 	r.MethodNotAllowedHandler = http.HandlerFunc(app.methodNotAllowedError)
-	r.Handle("/v1/healthcheck", app.rateLimit(http.HandlerFunc(app.healthCheckHandler)))
+	r.Handle("/v1/healthcheck", app.rateLimit(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.healthCheckHandler))), "default"))
+	r.Handle("/v1/health/live", app.acceptJSON(app.validateRequest(http.HandlerFunc(app.livenessHandler)))).Methods(http.MethodGet)
+	r.Handle("/v1/health/ready", app.acceptJSON(app.validateRequest(http.HandlerFunc(app.readinessHandler)))).Methods(http.MethodGet)
+
+	r.Handle("/v1/movies", app.deprecated(app.rateLimit(app.requirePermission(app.validateRequest(http.HandlerFunc(app.listMoviesHandler)), "movies:read"), "movies"))).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v1/movies", app.deprecated(app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(app.idempotent(http.HandlerFunc(app.createMovieHandler))))), "movies:write"), "movies"))).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/movies/{id:[0-9]+}", app.deprecated(app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(http.HandlerFunc(app.updateMovieHandler)))), "movies:write"), "movies"))).Methods(http.MethodPut, http.MethodOptions)
+	r.Handle("/v1/movies/{id:[0-9]+}", app.deprecated(app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(http.HandlerFunc(app.partialUpdateMovieHandler)))), "movies:write"), "movies"))).Methods(http.MethodPatch, http.MethodOptions)
+	r.Handle("/v1/movies/{id:[0-9]+}", app.deprecated(app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.showMovieHandler))), "movies:read"), "movies"))).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v1/movies/{id:[0-9]+}", app.deprecated(app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.deleteMovieHandler))), "movies:write"), "movies"))).Methods(http.MethodDelete, http.MethodOptions)
 
-	r.Handle("/v1/movies", app.requirePermission(app.rateLimit(http.HandlerFunc(app.listMoviesHandler)), "movies:read")).Methods(http.MethodGet, http.MethodOptions)
-	r.Handle("/v1/movies", app.requirePermission(app.rateLimit(http.HandlerFunc(app.createMovieHandler)), "movies:write")).Methods(http.MethodPost, http.MethodOptions)
-	r.Handle("/v1/movies/{id:[0-9]+}", app.requirePermission(app.rateLimit(http.HandlerFunc(app.updateMovieHandler)), "movies:write")).Methods(http.MethodPut, http.MethodOptions)
-	r.Handle("/v1/movies/{id:[0-9]+}", app.requirePermission(app.rateLimit(http.HandlerFunc(app.partialUpdateMovieHandler)), "movies:write")).Methods(http.MethodPatch, http.MethodOptions)
-	r.Handle("/v1/movies/{id:[0-9]+}", app.requirePermission(app.rateLimit(http.HandlerFunc(app.showMovieHandler)), "movies:read")).Methods(http.MethodGet, http.MethodOptions)
-	r.Handle("/v1/movies/{id:[0-9]+}", app.requirePermission(app.rateLimit(http.HandlerFunc(app.deleteMovieHandler)), "movies:write")).Methods(http.MethodDelete, http.MethodOptions)
+	r.Handle("/v2/movies", app.rateLimit(app.requirePermission(app.validateRequest(http.HandlerFunc(app.listMoviesV2Handler)), "movies:read"), "movies")).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v2/movies", app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(app.idempotent(http.HandlerFunc(app.createMovieV2Handler))))), "movies:write"), "movies")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v2/movies/{id:[0-9]+}", app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(http.HandlerFunc(app.updateMovieV2Handler)))), "movies:write"), "movies")).Methods(http.MethodPut, http.MethodOptions)
+	r.Handle("/v2/movies/{id:[0-9]+}", app.rateLimit(app.requirePermission(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(http.HandlerFunc(app.partialUpdateMovieV2Handler)))), "movies:write"), "movies")).Methods(http.MethodPatch, http.MethodOptions)
+	r.Handle("/v2/movies/{id:[0-9]+}", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.showMovieV2Handler))), "movies:read"), "movies")).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v2/movies/{id:[0-9]+}", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.deleteMovieHandler))), "movies:write"), "movies")).Methods(http.MethodDelete, http.MethodOptions)
 
-	r.Handle("/v1/users", app.rateLimit(http.HandlerFunc(app.registerUserHandler))).Methods(http.MethodPost, http.MethodOptions)
-	r.Handle("/v1/users/activated", app.rateLimit(http.HandlerFunc(app.activateUserHandler))).Methods(http.MethodPut, http.MethodOptions)
-	r.Handle("/v1/tokens/authentication", app.metrics(app.rateLimit(http.HandlerFunc(app.createAuthenticationTokenHandler)))).Methods(http.MethodPost, http.MethodOptions)
-	r.Handle("/v1/metrics", app.metrics(expvar.Handler()))
+	r.Handle("/v1/users", app.rateLimit(app.acceptJSON(app.maxBody(8<<10, app.validateRequest(app.idempotent(http.HandlerFunc(app.registerUserHandler))))), "users")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/users/activated", app.rateLimit(app.acceptJSON(app.maxBody(8<<10, app.validateRequest(http.HandlerFunc(app.activateUserHandler)))), "users")).Methods(http.MethodPut, http.MethodOptions)
+	r.Handle("/v1/users/me/usage", app.rateLimit(app.requiredActivatedUser(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.showUsageHandler)))), "users")).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v1/tokens/authentication", app.rateLimit(app.acceptJSON(app.maxBody(8<<10, app.validateRequest(http.HandlerFunc(app.createAuthenticationTokenHandler)))), "tokens")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/admin/mailer/templates", app.rateLimit(app.requirePermission(app.validateRequest(http.HandlerFunc(app.listTemplatesHandler)), "mailer:admin"), "admin")).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v1/admin/mailer/templates/{name:[a-z0-9_]+\\.tmpl}/preview", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.previewTemplateHandler))), "mailer:admin"), "admin")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/admin/mailer/templates/{name:[a-z0-9_]+\\.tmpl}/send", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.sendTestTemplateHandler))), "mailer:admin"), "admin")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/admin/config", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.showConfigHandler))), "config:admin"), "admin")).Methods(http.MethodGet, http.MethodOptions)
+	r.Handle("/v1/admin/config/reload", app.rateLimit(app.requirePermission(app.acceptJSON(app.validateRequest(http.HandlerFunc(app.reloadConfigHandler))), "config:admin"), "admin")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/mailer/events", app.rateLimit(app.requireWebhookSecret(app.acceptJSON(app.maxBody(64<<10, app.validateRequest(http.HandlerFunc(app.mailerEventsHandler))))), "mailer")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/batch", app.rateLimit(app.enforceQuota(app.acceptJSON(app.maxBody(256<<10, app.validateRequest(http.HandlerFunc(app.batchHandler))))), "batch")).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/v1/metrics", app.rateLimit(app.requirePermission(app.acceptJSON(expvar.Handler()), "metrics:read"), "metrics")).Methods(http.MethodGet)
+	r.Handle("/v1/metrics/prometheus", app.rateLimit(app.requirePermission(app.metrics.registry.Handler(), "metrics:read"), "metrics")).Methods(http.MethodGet)
+	r.Handle("/v1/openapi.json", app.acceptJSON(app.validateRequest(http.HandlerFunc(app.openAPIHandler)))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/docs", app.docsHandler).Methods(http.MethodGet)
+	r.Use(app.recordRoute)
+	r.Use(app.compress)
 	r.Use(app.recoverPanic)
 	r.Use(app.authenticate)
 	r.Use(app.enableCORS)
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,44 +17,86 @@ import (
 )
 
 func (app *application) serve() error {
+	cfg := app.config()
+
+	// Every request context derives from baseCtx, so cancelling it aborts the
+	// DB queries of requests that outlive the HTTP shutdown timeout.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.cfg.port),
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ErrorLog:     log.New(&zapLogger{zap.S().Desugar()}, "", 0),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
 
-	shutdownError := make(chan error)
+	shutdownDone := make(chan struct{})
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	abortCtx, abortJobs := context.WithCancel(context.Background())
+	defer abortJobs()
+	app.startOutboxRelay(relayCtx, abortCtx)
+	app.startIdempotencySweeper(relayCtx)
+	app.reloadOnSIGHUP(relayCtx.Done())
+
+	if cfg.TLS.CertFile != "" {
+		certs, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		certs.watch(relayCtx, cfg.TLS.ReloadInterval)
+		srv.TLSConfig = newTLSConfig(cfg, certs)
+	}
 
 	go func() {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 		str := <-ch
-		zap.S().Errorw(fmt.Sprintf("%v", str))
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		shutdown := app.config().Shutdown
+		zap.S().Infow("shutting down", "signal", str.String())
+
+		atomic.StoreInt32(&app.stopping, 1)
+		zap.S().Infow("draining traffic", "period", shutdown.DrainPeriod.String())
+		// A second signal asks to stop now rather than wait for the period.
+		select {
+		case <-time.After(shutdown.DrainPeriod):
+		case str := <-ch:
+			zap.S().Infow("skipping the drain period", "signal", str.String())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdown.HTTPTimeout)
 		defer cancel()
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+		if err := srv.Shutdown(ctx); err != nil {
+			zap.S().Errorw("in-flight requests did not complete in time, cancelling them", "timeout", shutdown.HTTPTimeout.String())
+			cancelRequests()
+			srv.Close()
 		}
 
-		zap.S().Infow("Completing background jobs")
-		app.wg.Wait()
-		shutdownError <- nil
+		stopRelay()
+		zap.S().Infow("completing background jobs", "timeout", shutdown.JobsTimeout.String())
+		if abandoned := app.waitBackground(shutdown.JobsTimeout); len(abandoned) > 0 {
+			zap.S().Errorw("abandoned background jobs", "jobs", abandoned)
+			abortJobs()
+		}
+		close(shutdownDone)
 	}()
 
-	err := srv.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
-		return err
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
 	}
-
-	err = <-shutdownError
-	if err != nil {
+	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
+	// A shutdown timeout has already been logged and handled by cancelling
+	// the requests, it is not a reason to exit with an error.
+	<-shutdownDone
 	zap.S().Infow("stopped server")
 	return nil
 }
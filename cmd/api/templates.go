@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/mailer"
+	"github.com/jersonsatoru/lets-go-further/internal/validator"
+)
+
+func (app *application) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := app.negotiateContentType(w, r, listMediaTypes...)
+	if !ok {
+		return
+	}
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeRepresentation(w, http.StatusOK, mediaType, envelope{"templates": templates}, func() table {
+		t := table{header: []string{"name", "locales"}}
+		for _, tmpl := range templates {
+			t.rows = append(t.rows, []string{tmpl.Name, strings.Join(tmpl.Locales, ",")})
+		}
+		return t
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type previewTemplateInput struct {
+	Locale string                 `json:"locale"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+func (app *application) previewTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input previewTemplateInput
+	if !app.bind(w, r, &input) {
+		return
+	}
+	msg, ok := app.renderTemplate(w, r, input.Locale, input.Data)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"email": envelope{
+		"locale":    msg.Locale,
+		"subject":   msg.Subject,
+		"plaintext": msg.Plaintext,
+		"htmlBody":  msg.HTMLBody,
+	}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type sendTestTemplateInput struct {
+	Recipient string                 `json:"recipient" validate:"required,format=email"`
+	Locale    string                 `json:"locale"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+func (app *application) sendTestTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input sendTestTemplateInput
+	if !app.bind(w, r, &input) {
+		return
+	}
+	v := validator.New()
+	if validateRecipient(v, input.Recipient); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	msg, ok := app.renderTemplate(w, r, input.Locale, input.Data)
+	if !ok {
+		return
+	}
+	email := &data.Email{
+		Template:  mux.Vars(r)["name"],
+		Locale:    msg.Locale,
+		Recipient: input.Recipient,
+		Status:    data.EmailQueued,
+	}
+	err := app.models.Emails.Insert(r.Context(), email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.sendEmail(r.Context(), app.models, &data.EmailMessage{
+		EmailID:   email.ID,
+		Recipient: email.Recipient,
+		Locale:    email.Locale,
+		Template:  email.Template,
+		Data:      input.Data,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailSuppressed):
+			app.failedValidationResponse(w, r, map[string]string{"recipient": "is on the suppression list"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "test email sent", "email_id": email.ID}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// renderTemplate renders the template named in the route and writes the error
+// response itself when rendering fails.
+func (app *application) renderTemplate(w http.ResponseWriter, r *http.Request, locale string, sample map[string]interface{}) (*mailer.Message, bool) {
+	msg, err := mailer.Render(locale, mux.Vars(r)["name"], sample)
+	if err != nil {
+		var templateError *mailer.TemplateError
+		switch {
+		case errors.Is(err, mailer.ErrTemplateNotFound):
+			app.notFoundErrorResponse(w, r)
+		case errors.As(err, &templateError):
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, "template_error", templateError.Error(), envelope{"template_error": templateError})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return msg, true
+}
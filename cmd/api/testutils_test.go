@@ -0,0 +1,89 @@
+package main
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/config"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/mailer"
+)
+
+var (
+	testMetricsOnce sync.Once
+	testMetrics     *appMetrics
+)
+
+// sharedTestMetrics returns the metrics of every test application, since the
+// expvar variables can only be published once per process. Their database
+// gauges read a mock without expectations, which reports zeros.
+func sharedTestMetrics() *appMetrics {
+	testMetricsOnce.Do(func() {
+		db, _, err := sqlmock.New()
+		if err != nil {
+			panic(err)
+		}
+		testMetrics = newAppMetrics(db)
+	})
+	return testMetrics
+}
+
+// newTestApplication returns an application backed by a mocked database and
+// the in-memory mailer, with the defaults of the configuration that the
+// handlers depend on. The database has a single connection, so code that
+// queries outside a transaction in progress times out instead of passing.
+// The mock expectations are checked when the test ends.
+func newTestApplication(t *testing.T) (*application, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	cfg := &config.Config{}
+	cfg.Env = "development"
+	cfg.Mailer.Transport = "memory"
+	cfg.Validation.Mode = validationEnforce
+	cfg.Versioning.Default = "v1"
+	cfg.Idempotency.TTL = 24 * time.Hour
+	cfg.Idempotency.Lock = time.Minute
+
+	app := &application{
+		models:  data.NewModels(db),
+		mailer:  mailer.NewMemory("Greenlight <no-reply@greenlight.test>"),
+		metrics: sharedTestMetrics(),
+		openapi: newOpenAPIDocument(),
+	}
+	app.cfg.Store(cfg)
+	return app, mock
+}
+
+// testToken is a well-formed authentication token, resolved to a user by the
+// expectations of expectAuthentication.
+const testToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// expectAuthentication expects the query made by authenticate for a request
+// authenticated with testToken as user.
+func expectAuthentication(mock sqlmock.Sqlmock, user *data.User) {
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE t.hash = $1")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "activated", "locale", "created_at", "version", "password_hash",
+			"name", "requests_per_minute", "daily_limit"}).
+			AddRow(user.ID, user.Name, user.Email, user.Activated, user.Locale, time.Now(), 1, []byte{},
+				user.Quota.Name, user.Quota.RequestsPerMinute, user.Quota.DailyLimit))
+}
+
+// expectUsage expects n requests of user to be counted by enforceQuota.
+func expectUsage(mock sqlmock.Sqlmock, user *data.User, n int) {
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_usage")).WithArgs(user.ID, user.Quota.DailyLimit, n).
+		WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(n))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/config"
+	"go.uber.org/zap"
+)
+
+// certReloader serves the key pair and the client CAs found on disk, loading
+// them again whenever one of their files changes so that renewed
+// certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+}
+
+// newCertReloader loads the key pair, and the client CAs unless caFile is
+// empty.
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the files again when any of them is newer than the ones in
+// use. A broken file is reported and the previous certificates are kept.
+func (r *certReloader) reload() error {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	modTime, err := latestModTime(files...)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && !modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		clientCAs, err = loadCertPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return pool, nil
+}
+
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.reload(); err != nil {
+					zap.S().Errorw("reloading TLS certificate failed", "error", err.Error(), "cert", r.certFile)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// newTLSConfig uses modern defaults only. HTTP/2 is negotiated through ALPN,
+// and client certificates are verified against the client CAs when given but
+// not required, so that token authentication keeps working.
+func newTLSConfig(cfg *config.Config, certs *certReloader) *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		tlsConfig.ClientCAs = certs.ClientCAs()
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		// The client CAs are read for every handshake so that a reloaded
+		// bundle applies to new connections.
+		base := tlsConfig.Clone()
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.ClientCAs = certs.ClientCAs()
+			return c, nil
+		}
+	}
+	return tlsConfig
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/config"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its
+// key to dir, with the given modification time, and returns the parsed
+// certificate.
+func writeCertificate(t *testing.T, dir, commonName string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Greenlight"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	files := map[string][]byte{
+		"cert.pem": certPEM,
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		"ca.pem":   certPEM,
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func servedCertificate(t *testing.T, r *certReloader) []byte {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	first := writeCertificate(t, dir, "first", start)
+	r, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(servedCertificate(t, r), first.Raw) {
+		t.Fatal("the loaded certificate is not the one on disk")
+	}
+	firstCAs := r.ClientCAs()
+
+	second := writeCertificate(t, dir, "second", start.Add(time.Minute))
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(servedCertificate(t, r), second.Raw) {
+		t.Error("the renewed certificate was not loaded")
+	}
+	if r.ClientCAs() == firstCAs {
+		t.Error("the renewed client CAs were not loaded")
+	}
+	if _, err := second.Verify(x509.VerifyOptions{Roots: r.ClientCAs()}); err != nil {
+		t.Errorf("the client CAs do not hold the renewed CA: %v", err)
+	}
+
+	broken := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(broken, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(broken, start.Add(2*time.Minute), start.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err == nil {
+		t.Error("reloading a broken certificate succeeded")
+	}
+	if !bytes.Equal(servedCertificate(t, r), second.Raw) {
+		t.Error("a broken certificate replaced the one in use")
+	}
+}
+
+func TestTLSConfigReadsTheClientCAsOnEveryHandshake(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeCertificate(t, dir, "first", start)
+	cfg := &config.Config{}
+	cfg.TLS.ClientCAFile = filepath.Join(dir, "ca.pem")
+	r, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), cfg.TLS.ClientCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := newTLSConfig(cfg, r)
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("client auth = %v, want VerifyClientCertIfGiven", tlsConfig.ClientAuth)
+	}
+
+	second := writeCertificate(t, dir, "second", start.Add(time.Minute))
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Verify(x509.VerifyOptions{Roots: c.ClientCAs}); err != nil {
+		t.Errorf("the handshake does not use the reloaded client CAs: %v", err)
+	}
+}
+
+var certificateUserColumns = []string{"id", "name", "email", "activated", "locale", "created_at", "version", "password_hash",
+	"name", "requests_per_minute", "daily_limit"}
+
+func TestAuthenticateMapsTheCertificateSubjectToAUser(t *testing.T) {
+	cert := writeCertificate(t, t.TempDir(), "billing", time.Now())
+	subject := "CN=billing,O=Greenlight"
+	tests := []struct {
+		name   string
+		rows   *sqlmock.Rows
+		want   int
+		userID int64
+	}{
+		{"known subject", sqlmock.NewRows(certificateUserColumns).
+			AddRow(12, "billing", "billing@greenlight.test", true, "en", time.Now(), 1, []byte{}, "internal", 6000, 0),
+			http.StatusOK, 12},
+		{"unknown subject", sqlmock.NewRows(certificateUserColumns), http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE c.subject = $1")).WithArgs(subject).WillReturnRows(tt.rows)
+
+			var userID int64
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID = r.Context().Value(contextUser("user")).(*data.User).ID
+			})
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: "test"}))
+			w := httptest.NewRecorder()
+			app.authenticate(next).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if userID != tt.userID {
+				t.Errorf("authenticated user %d, want %d", userID, tt.userID)
+			}
+			if info := requestInfoFromContext(r.Context()); info.userID != tt.userID {
+				t.Errorf("request info user %d, want %d", info.userID, tt.userID)
+			}
+		})
+	}
+}
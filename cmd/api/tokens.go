@@ -10,14 +10,14 @@ import (
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
 )
 
+type authenticationTokenInput struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	var input authenticationTokenInput
+	if !app.bind(w, r, &input) {
 		return
 	}
 	v := validator.New()
@@ -28,7 +28,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -47,12 +47,12 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-	err = app.models.Tokens.DeleteAllForUser(data.ScopedAuthentication, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopedAuthentication, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	token, err := app.models.Tokens.New(user.ID, time.Duration(time.Hour*3*24), data.ScopedAuthentication)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, time.Duration(time.Hour*3*24), data.ScopedAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
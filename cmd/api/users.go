@@ -8,29 +8,35 @@ import (
 	"time"
 
 	"github.com/jersonsatoru/lets-go-further/internal/data"
+	"github.com/jersonsatoru/lets-go-further/internal/i18n"
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
-	"go.uber.org/zap"
 )
 
+type registerUserInput struct {
+	Name     string `json:"name" validate:"required,minLength=1,maxLength=500"`
+	Email    string `json:"email" validate:"required,format=email"`
+	Password string `json:"password" validate:"required,minLength=8,maxLength=72"`
+	Locale   string `json:"locale"`
+}
+
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input registerUserInput
 
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	if !app.bind(w, r, &input) {
 		return
 	}
 
+	if input.Locale == "" {
+		input.Locale = i18n.Match(r.Header.Get("Accept-Language"))
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    i18n.Normalize(input.Locale),
 	}
-	err = user.Password.Set(input.Password)
+	err := user.Password.Set(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -42,7 +48,32 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+		err = tx.Permission.AddForUser(r.Context(), user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+		token, err := tx.Tokens.New(r.Context(), user.ID, time.Duration(time.Hour*3*24), data.ScopedActivation)
+		if err != nil {
+			return err
+		}
+		err = app.queueEmail(r.Context(), tx, user.Email, user.Locale, "user_welcome.tmpl", map[string]interface{}{
+			"userID":          user.ID,
+			"activationToken": token.Plaintext,
+		})
+		if err != nil {
+			return err
+		}
+		event, err := data.NewOutboxEntry(data.TopicUserRegistered, envelope{"user": user})
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Insert(r.Context(), event)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -53,34 +84,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.models.Permission.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	token, err := app.models.Tokens.New(user.ID, time.Duration(time.Hour*3*24), data.ScopedActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	app.wg.Add(1)
-	go func(app *application) {
-		defer app.wg.Done()
-		defer func() {
-			if err := recover(); err != nil {
-				zap.S().Errorw(fmt.Sprintf("%v", err), "Recipient", user.Email)
-			}
-		}()
-		time.Sleep(3 * time.Second)
-		data := map[string]interface{}{
-			"userID":          user.ID,
-			"activationToken": token.Plaintext,
-		}
-		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			zap.S().Errorw(err.Error(), "Recipient", user.Email)
-		}
-	}(app)
 
 	env := envelope{"user": user}
 	b, err := json.Marshal(env)
@@ -94,13 +97,13 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	w.Write(b)
 }
 
+type activateUserInput struct {
+	TokenPlaintext string `json:"token" validate:"required,minLength=26,maxLength=26"`
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TokenPlaintext string `json:"token"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	var input activateUserInput
+	if !app.bind(w, r, &input) {
 		return
 	}
 	v := validator.New()
@@ -108,7 +111,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.models.Users.GetForToken(input.TokenPlaintext, data.ScopedActivation)
+	user, err := app.models.Users.GetForToken(r.Context(), input.TokenPlaintext, data.ScopedActivation)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -118,7 +121,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 	user.Activated = true
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -128,7 +131,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.models.Tokens.DeleteAllForUser(data.ScopedActivation, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopedActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -138,3 +141,20 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) showUsageHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextUser("user")).(*data.User)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("invalid context value"))
+		return
+	}
+	usage, err := app.models.Usage.GetForUser(r.Context(), user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"usage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jersonsatoru/lets-go-further/internal/openapi"
+)
+
+const (
+	validationEnforce = "enforce"
+	validationLog     = "log"
+	validationOff     = "off"
+)
+
+// validateRequest checks the path and query parameters and the JSON body of
+// requests against their operation in the OpenAPI document before next runs.
+// It wraps each route inside its rate limit and permission checks, and inside
+// maxBody. In log mode invalid requests are only logged.
+//
+// Bodies the handler could not bind, because of their content type, size or
+// syntax, are left for bind to report. Handlers leave the constraints stated
+// in the document to this check.
+func (app *application) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := app.config().Validation.Mode
+		if mode == validationOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op := app.operationFor(r)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		errs := make(map[string]string)
+		vars := mux.Vars(r)
+		qs := r.URL.Query()
+		for _, p := range op.Parameters {
+			var raw string
+			var present bool
+			switch p.In {
+			case "path":
+				raw, present = vars[p.Name]
+			case "query":
+				_, present = qs[p.Name]
+				raw = qs.Get(p.Name)
+			}
+			if !present {
+				if p.Required {
+					errs[p.Name] = "must be provided"
+				}
+				continue
+			}
+			if reason := app.openapi.ValidateParameter(p, raw); reason != "" {
+				errs[p.Name] = reason
+			}
+		}
+		if op.RequestBody != nil {
+			app.validateBody(r, op.RequestBody, errs)
+		}
+
+		if len(errs) > 0 {
+			if mode == validationLog {
+				app.logger(r.Context()).Warnw("request does not match the OpenAPI document", "errors", errs)
+			} else {
+				app.failedValidationResponse(w, r, errs)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) operationFor(r *http.Request) *openapi.Operation {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	path, _ := openapi.PathFromTemplate(template)
+	return app.openapi.Paths[path].Operation(r.Method)
+}
+
+// validateBody reads the body, puts it back for the handler and validates it
+// against the schema of its media type.
+func (app *application) validateBody(r *http.Request, body *openapi.RequestBody, errs map[string]string) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return
+	}
+	content, ok := body.Content[mediaType]
+	if !ok {
+		return
+	}
+
+	limit := maxBodyBytes(r)
+	b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	if err != nil || int64(len(b)) > limit {
+		return
+	}
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return
+	}
+	app.openapi.Validate(content.Schema, value, "", errs)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jersonsatoru/lets-go-further/internal/data"
+)
+
+func TestValidateRequestRunsInsideEachRoute(t *testing.T) {
+	invalidMovie := `{"title":"","year":1800,"runtime_minutes":90,"genres":["drama"]}`
+	tests := []struct {
+		name          string
+		path          string
+		header        map[string]string
+		body          string
+		authenticated bool
+		want          int
+	}{
+		{"permission checked first", "/v2/movies", nil, invalidMovie, false, http.StatusUnauthorized},
+		{"invalid body", "/v2/movies", nil, invalidMovie, true, http.StatusUnprocessableEntity},
+		{"webhook secret checked first", "/v1/mailer/events", map[string]string{"X-Webhook-Secret": "wrong"}, `{"type":"unknown"}`, false, http.StatusUnauthorized},
+		{"body over the route limit left to bind", "/v1/users", nil, `{"name":"` + strings.Repeat("a", 9<<10) + `","email":"a@b.test","password":"pa55word"}`, false, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			app.config().Mailer.WebhookSecret = "secret"
+			if tt.authenticated {
+				user := &data.User{ID: 5, Activated: true, Quota: data.QuotaTier{Name: "free"}}
+				expectAuthentication(mock, user)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT p.code")).WithArgs(user.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("movies:write"))
+				expectUsage(mock, user, 1)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", mediaTypeJSON)
+			if tt.authenticated {
+				r.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			app.router().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestValidateRequestReportsEveryField(t *testing.T) {
+	app, _ := newTestApplication(t)
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"name":"","email":"nope","password":"short"}`))
+	r.Header.Set("Content-Type", mediaTypeJSON)
+	w := httptest.NewRecorder()
+	app.router().ServeHTTP(w, r)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+	}
+	for _, field := range []string{"name", "email", "password"} {
+		if !strings.Contains(w.Body.String(), `"`+field+`"`) {
+			t.Errorf("no error for %s in %s", field, w.Body)
+		}
+	}
+}
+
+func TestHandlersCheckRecipientsWithValidationOff(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		body   string
+		fields []string
+	}{
+		{"mailer event", "/v1/mailer/events", map[string]string{"X-Webhook-Secret": "secret"},
+			`{"type":"delivered","recipient":""}`, []string{"type", "recipient"}},
+		{"test email", "/v1/admin/mailer/templates/user_welcome.tmpl/send", map[string]string{"Authorization": "Bearer " + testToken},
+			`{"recipient":"nope","locale":"en"}`, []string{"recipient"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			app.config().Mailer.WebhookSecret = "secret"
+			app.config().Validation.Mode = validationOff
+			if tt.header["Authorization"] != "" {
+				user := &data.User{ID: 5, Activated: true, Quota: data.QuotaTier{Name: "free"}}
+				expectAuthentication(mock, user)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT p.code")).WithArgs(user.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("mailer:admin"))
+				expectUsage(mock, user, 1)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", mediaTypeJSON)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			app.router().ServeHTTP(w, r)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+			}
+			for _, field := range tt.fields {
+				if !strings.Contains(w.Body.String(), `"`+field+`"`) {
+					t.Errorf("no error reported for %s: %s", field, w.Body)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
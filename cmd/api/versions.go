@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiVersions are the route sets mounted by routes, each under its own path
+// prefix.
+var apiVersions = []string{"v1", "v2"}
+
+// selectVersion serves unversioned paths such as /movies from the version
+// named by the API-Version header, or from the configured default one. The
+// version that served the request is echoed in the API-Version header.
+func (app *application) selectVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "API-Version")
+		version := pathVersion(r.URL.Path)
+		if version == "" {
+			version = strings.ToLower(r.Header.Get("API-Version"))
+			if version == "" {
+				version = app.config().Versioning.Default
+			}
+			if !strings.HasPrefix(version, "v") {
+				version = "v" + version
+			}
+			if pathVersion("/"+version+"/") == "" {
+				app.badRequestResponse(w, r, fmt.Errorf("API-Version must be one of %s", strings.Join(apiVersions, ", ")))
+				return
+			}
+			r.URL.Path = "/" + version + r.URL.Path
+			r.URL.RawPath = ""
+		}
+		w.Header().Set("API-Version", version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func pathVersion(path string) string {
+	for _, v := range apiVersions {
+		if strings.HasPrefix(path, "/"+v+"/") {
+			return v
+		}
+	}
+	return ""
+}
+
+// deprecated marks a v1 route replaced in v2 with the Deprecation (RFC 9745)
+// and Sunset (RFC 8594) headers once they are scheduled, and links to its
+// successor.
+func (app *application) deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versioning := app.config().Versioning
+		if !versioning.V1Deprecation.IsZero() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", versioning.V1Deprecation.Unix()))
+		}
+		if !versioning.V1Sunset.IsZero() {
+			w.Header().Set("Sunset", versioning.V1Sunset.UTC().Format(http.TimeFormat))
+		}
+		successor := "/v2" + strings.TrimPrefix(r.URL.Path, "/v1")
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		next.ServeHTTP(w, r)
+	})
+}
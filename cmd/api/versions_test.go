@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSelectVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		fallback string
+		want     int
+		path2    string
+		version  string
+	}{
+		{"versioned path", "/v2/movies", "v1", "v1", http.StatusOK, "/v2/movies", "v2"},
+		{"default version", "/movies", "", "v1", http.StatusOK, "/v1/movies", "v1"},
+		{"other default version", "/movies", "", "v2", http.StatusOK, "/v2/movies", "v2"},
+		{"header", "/movies/1", "v2", "v1", http.StatusOK, "/v2/movies/1", "v2"},
+		{"header without v", "/movies", "2", "v1", http.StatusOK, "/v2/movies", "v2"},
+		{"header in upper case", "/movies", "V2", "v1", http.StatusOK, "/v2/movies", "v2"},
+		{"unknown version", "/movies", "v3", "v1", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config().Versioning.Default = tt.fallback
+			var served string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = r.URL.Path
+			})
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("API-Version", tt.header)
+			}
+			w := httptest.NewRecorder()
+			app.selectVersion(next).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d", w.Code, tt.want)
+			}
+			if served != tt.path2 {
+				t.Errorf("served %q, want %q", served, tt.path2)
+			}
+			if got := w.Header().Get("API-Version"); got != tt.version {
+				t.Errorf("got API-Version %q, want %q", got, tt.version)
+			}
+			if got := w.Header().Get("Vary"); got != "API-Version" {
+				t.Errorf("got Vary %q, want API-Version", got)
+			}
+		})
+	}
+}
+
+func TestDeprecatedHeaders(t *testing.T) {
+	app, _ := newTestApplication(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func() http.Header {
+		w := httptest.NewRecorder()
+		app.deprecated(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/movies/7", nil))
+		return w.Header()
+	}
+
+	h := serve()
+	if h.Get("Deprecation") != "" || h.Get("Sunset") != "" {
+		t.Errorf("unscheduled deprecation sent Deprecation %q and Sunset %q", h.Get("Deprecation"), h.Get("Sunset"))
+	}
+	if got, want := h.Get("Link"), `</v2/movies/7>; rel="successor-version"`; got != want {
+		t.Errorf("got Link %q, want %q", got, want)
+	}
+
+	cfg := app.config()
+	cfg.Versioning.V1Deprecation = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.Versioning.V1Sunset = time.Date(2026, 7, 1, 12, 0, 0, 0, time.FixedZone("BRT", -3*60*60))
+	h = serve()
+	if got, want := h.Get("Deprecation"), "@1767225600"; got != want {
+		t.Errorf("got Deprecation %q, want %q", got, want)
+	}
+	if got, want := h.Get("Sunset"), "Wed, 01 Jul 2026 15:00:00 GMT"; got != want {
+		t.Errorf("got Sunset %q, want %q", got, want)
+	}
+}
+
+// TestDeprecatedRoutesHaveASuccessor checks that the successor-version link
+// of every deprecated route leads to a route serving the same method.
+func TestDeprecatedRoutesHaveASuccessor(t *testing.T) {
+	app := &application{metrics: sharedTestMetrics()}
+	router := app.router()
+	for _, doc := range routeDocs {
+		if !doc.deprecated {
+			continue
+		}
+		successor := "/v2" + strings.TrimPrefix(doc.path, "/v1")
+		successor = strings.Replace(successor, "{id:[0-9]+}", "1", 1)
+		var match mux.RouteMatch
+		r := httptest.NewRequest(doc.method, successor, nil)
+		if !router.Match(r, &match) || match.MatchErr != nil {
+			t.Errorf("%s %s is deprecated but %s %s is not served", doc.method, doc.path, doc.method, successor)
+		}
+	}
+}
@@ -3,14 +3,17 @@ module github.com/jersonsatoru/lets-go-further
 go 1.16
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/andybalholm/brotli v1.0.5
 	github.com/felixge/httpsnoop v1.0.2
 	github.com/go-mail/mail/v2 v2.3.0
 	github.com/gorilla/mux v1.8.0
 	github.com/lib/pq v1.10.4
 	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.uber.org/zap v1.20.0
 	golang.org/x/crypto v0.0.0-20220209195652-db638375bc3a
-	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1 +0,0 @@
-CREATE EXTENSION IF NOT EXISTS citext;
\ No newline at end of file
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/jersonsatoru/lets-go-further/internal/ratelimit"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole configuration of the API. Every field can be set, from
+// lowest to highest precedence, by its default tag, the YAML config file, its
+// env variable and its flag. Fields tagged reload can change while the server
+// runs, by editing the config file; every other change needs a restart.
+type Config struct {
+	Port int    `yaml:"port" env:"APP_PORT" flag:"port" default:"4000" usage:"API server port"`
+	Env  string `yaml:"env" env:"APP_ENV" flag:"env" default:"development" usage:"Environment (development|staging|production)"`
+	Log  struct {
+		Level zapcore.Level `yaml:"level" env:"LOG_LEVEL" flag:"logLevel" default:"info" reload:"true" usage:"Minimum log level (debug|info|warn|error)"`
+	} `yaml:"log"`
+	TLS struct {
+		CertFile       string        `yaml:"cert_file" env:"TLS_CERT_FILE" flag:"tlsCert" usage:"PEM certificate file; enables HTTPS together with tlsKey"`
+		KeyFile        string        `yaml:"key_file" env:"TLS_KEY_FILE" flag:"tlsKey" usage:"PEM private key file"`
+		ClientCAFile   string        `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" flag:"tlsClientCA" usage:"PEM bundle of CAs trusted to sign client certificates; enables mTLS"`
+		ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" flag:"tlsReloadInterval" default:"30s" usage:"How often the certificate files are checked for changes"`
+	} `yaml:"tls"`
+	Shutdown struct {
+		DrainPeriod time.Duration `yaml:"drain_period" env:"SHUTDOWN_DRAIN_PERIOD" flag:"shutdownDrainPeriod" default:"5s" usage:"How long to keep serving while reporting not ready, so that load balancers stop sending traffic. A second signal ends it early"`
+		HTTPTimeout time.Duration `yaml:"http_timeout" env:"SHUTDOWN_HTTP_TIMEOUT" flag:"shutdownHTTPTimeout" default:"20s" usage:"How long in-flight requests may take to complete before they are cancelled"`
+		JobsTimeout time.Duration `yaml:"jobs_timeout" env:"SHUTDOWN_JOBS_TIMEOUT" flag:"shutdownJobsTimeout" default:"30s" usage:"How long background jobs may take to complete before they are abandoned"`
+	} `yaml:"shutdown"`
+	DB struct {
+		DSN          Secret        `yaml:"dsn" env:"DSN" flag:"dsn" usage:"Data Source Name (DSN)"`
+		MaxOpenConns int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" flag:"maxOpenConns" default:"25" usage:"Max open connections"`
+		MaxIdleConns int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" flag:"maxIdleConns" default:"25" usage:"Max idle connections"`
+		MaxIdleTime  time.Duration `yaml:"max_idle_time" env:"DB_MAX_IDLE_TIME" flag:"maxIdleTime" default:"15m" usage:"Max time a connection may stay idle"`
+		AutoMigrate  bool          `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" flag:"migrate" usage:"Apply pending migrations on startup"`
+	} `yaml:"db"`
+	Limiter struct {
+		RPS      float64            `yaml:"rps" env:"LIMITER_RPS" flag:"limiterRPS" default:"2" reload:"true" usage:"Requests per second of the default policy"`
+		Burst    int                `yaml:"burst" env:"LIMITER_BURST" flag:"limiterBurst" default:"4" reload:"true" usage:"Burst of the default policy"`
+		Enabled  bool               `yaml:"enabled" env:"LIMITER_ENABLED" flag:"limiterEnabled" default:"true" reload:"true" usage:"Enable Limiter"`
+		Store    string             `yaml:"store" env:"LIMITER_STORE" flag:"limiterStore" default:"memory" usage:"Limiter store (memory|postgres)"`
+		Policies ratelimit.Policies `yaml:"policies" env:"LIMITER_POLICIES" flag:"limiterPolicies" reload:"true" usage:"Per route group limiter policies, e.g. \"tokens=5/1m:ip movies=120/1m:user\""`
+	} `yaml:"limiter"`
+	SMTP struct {
+		Host     string `yaml:"host" env:"SMTP_HOST" flag:"smtpHost" usage:"SMTP Host"`
+		Port     int    `yaml:"port" env:"SMTP_PORT" flag:"smtpPort" default:"25" usage:"SMTP Port"`
+		Username string `yaml:"username" env:"SMTP_USERNAME" flag:"smtpUsername" usage:"SMTP Username"`
+		Password Secret `yaml:"password" env:"SMTP_PASSWORD" flag:"smtpPassword" usage:"SMTP Password"`
+		Sender   string `yaml:"sender" env:"SMTP_SENDER" flag:"smtpSender" usage:"SMTP Sender"`
+	} `yaml:"smtp"`
+	Mailer struct {
+		Transport     string `yaml:"transport" env:"MAILER_TRANSPORT" flag:"mailerTransport" default:"smtp" usage:"Mailer transport (smtp|file|log|memory)"`
+		Dir           string `yaml:"dir" env:"MAILER_DIR" flag:"mailerDir" default:"./tmp/mail" usage:"Directory used by the file mailer transport"`
+		WebhookSecret Secret `yaml:"webhook_secret" env:"MAILER_WEBHOOK_SECRET" flag:"mailerWebhookSecret" usage:"Shared secret expected on mailer event webhooks"`
+	} `yaml:"mailer"`
+	CORS struct {
+		TrustedOrigins []string `yaml:"trusted_origins" env:"CORS_TRUSTED_ORIGINS" flag:"corsTrustedOrigins" reload:"true" usage:"Space separated list of trusted CORS origins"`
+	} `yaml:"cors"`
+	Compression struct {
+		Enabled bool `yaml:"enabled" env:"COMPRESSION_ENABLED" flag:"compressionEnabled" default:"true" reload:"true" usage:"Compress responses with gzip or brotli when the client accepts it"`
+		MinSize int  `yaml:"min_size" env:"COMPRESSION_MIN_SIZE" flag:"compressionMinSize" default:"1024" reload:"true" usage:"Smallest response body in bytes that is compressed"`
+	} `yaml:"compression"`
+	Idempotency struct {
+		TTL  time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" flag:"idempotencyTTL" default:"24h" reload:"true" usage:"How long responses to requests with an Idempotency-Key are replayed"`
+		Lock time.Duration `yaml:"lock" env:"IDEMPOTENCY_LOCK" flag:"idempotencyLock" default:"1m" reload:"true" usage:"How long an idempotency key stays claimed by a request that never completes"`
+	} `yaml:"idempotency"`
+	OpenAPI struct {
+		DocsUI bool `yaml:"docs_ui" env:"OPENAPI_DOCS_UI" flag:"docsUI" reload:"true" usage:"Serve the API documentation UI at /v1/docs"`
+	} `yaml:"openapi"`
+	Versioning struct {
+		Default       string    `yaml:"default" env:"API_DEFAULT_VERSION" flag:"apiDefaultVersion" default:"v1" reload:"true" usage:"API version served on unversioned paths when the request has no API-Version header"`
+		V1Deprecation time.Time `yaml:"v1_deprecation" env:"API_V1_DEPRECATION" flag:"apiV1Deprecation" reload:"true" usage:"When the /v1 routes replaced in /v2 were deprecated (RFC 3339)"`
+		V1Sunset      time.Time `yaml:"v1_sunset" env:"API_V1_SUNSET" flag:"apiV1Sunset" reload:"true" usage:"When the /v1 routes replaced in /v2 will be removed (RFC 3339)"`
+	} `yaml:"versioning"`
+	Validation struct {
+		Mode string `yaml:"mode" env:"VALIDATION_MODE" flag:"validationMode" default:"enforce" reload:"true" usage:"Validation of requests against the OpenAPI document (enforce|log|off)"`
+	} `yaml:"validation"`
+	Health struct {
+		CacheTTL         time.Duration `yaml:"cache_ttl" env:"HEALTH_CACHE_TTL" flag:"healthCacheTTL" default:"5s" usage:"How long readiness check results are cached"`
+		Timeout          time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" flag:"healthTimeout" default:"2s" usage:"Timeout of each readiness check"`
+		MaxOutboxBacklog int           `yaml:"max_outbox_backlog" env:"HEALTH_MAX_OUTBOX_BACKLOG" flag:"healthMaxOutboxBacklog" default:"1000" usage:"Outbox backlog above which the service is not ready (0 disables)"`
+	} `yaml:"health"`
+	Tracing struct {
+		Exporter     string `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracingExporter" default:"none" usage:"Tracing exporter (none|stdout|file|otlp)"`
+		File         string `yaml:"file" env:"TRACING_FILE" flag:"tracingFile" default:"./tmp/traces.jsonl" usage:"File written by the file tracing exporter"`
+		OTLPEndpoint string `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" flag:"tracingOTLPEndpoint" default:"http://localhost:4318/v1/traces" usage:"OTLP/HTTP traces endpoint"`
+		ServiceName  string `yaml:"service_name" env:"TRACING_SERVICE_NAME" flag:"tracingServiceName" default:"greenlight" usage:"Service name reported on spans"`
+	} `yaml:"tracing"`
+}
+
+// Secret is a string that is never printed, so that dumping the effective
+// configuration or logging it does not leak credentials.
+type Secret string
+
+const redacted = "[redacted]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Validate checks the whole configuration and reports every problem at once.
+func (c *Config) Validate() error {
+	var errs Errors
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+	oneOf := func(value string, allowed ...string) bool {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port", "must be between 1 and 65535")
+	check(oneOf(c.Env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls", "cert_file and key_file must be provided together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "tls.client_ca_file", "requires cert_file and key_file")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval", "must be greater than zero")
+
+	check(c.Shutdown.DrainPeriod >= 0, "shutdown.drain_period", "must not be negative")
+	check(c.Shutdown.HTTPTimeout > 0, "shutdown.http_timeout", "must be greater than zero")
+	check(c.Shutdown.JobsTimeout > 0, "shutdown.jobs_timeout", "must be greater than zero")
+
+	check(c.DB.DSN != "", "db.dsn", "must be provided")
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns", "must not be negative")
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns", "must not be negative")
+	check(c.DB.MaxIdleTime > 0, "db.max_idle_time", "must be greater than zero")
+
+	check(oneOf(c.Limiter.Store, "memory", "postgres"), "limiter.store", "must be memory or postgres")
+	if c.Limiter.Enabled {
+		check(c.Limiter.RPS > 0, "limiter.rps", "must be greater than zero when the limiter is enabled")
+		check(c.Limiter.Burst > 0, "limiter.burst", "must be greater than zero when the limiter is enabled")
+		check(c.Limiter.RPS <= 0 || float64(c.Limiter.Burst)/c.Limiter.RPS >= 0.001, "limiter.rps",
+			"must not be more than 1000 times limiter.burst, the default window would be shorter than 1ms")
+	}
+
+	check(oneOf(c.Mailer.Transport, "smtp", "file", "log", "memory"), "mailer.transport", "must be smtp, file, log or memory")
+	if c.Mailer.Transport == "smtp" {
+		check(c.SMTP.Host != "", "smtp.host", "must be provided for the smtp transport")
+		check(c.SMTP.Port > 0 && c.SMTP.Port <= 65535, "smtp.port", "must be between 1 and 65535")
+	}
+	if c.Mailer.Transport == "file" {
+		check(c.Mailer.Dir != "", "mailer.dir", "must be provided for the file transport")
+	}
+	check(c.Mailer.Transport != "memory" || c.Env == "development", "mailer.transport",
+		"memory keeps every email until restart and is only allowed in development")
+
+	for _, origin := range c.CORS.TrustedOrigins {
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "", "cors.trusted_origins", "%q is not an origin", origin)
+	}
+
+	check(c.Compression.MinSize >= 0, "compression.min_size", "must not be negative")
+
+	check(c.Idempotency.TTL > 0, "idempotency.ttl", "must be positive")
+	check(c.Idempotency.Lock > 0, "idempotency.lock", "must be positive")
+
+	check(oneOf(c.Versioning.Default, "v1", "v2"), "versioning.default", "must be v1 or v2")
+	check(c.Versioning.V1Sunset.IsZero() || c.Versioning.V1Sunset.After(c.Versioning.V1Deprecation),
+		"versioning.v1_sunset", "must be after versioning.v1_deprecation")
+
+	check(oneOf(c.Validation.Mode, "enforce", "log", "off"), "validation.mode", "must be enforce, log or off")
+
+	check(c.Health.CacheTTL >= 0, "health.cache_ttl", "must not be negative")
+	check(c.Health.Timeout > 0, "health.timeout", "must be greater than zero")
+	check(c.Health.MaxOutboxBacklog >= 0, "health.max_outbox_backlog", "must not be negative")
+
+	check(oneOf(c.Tracing.Exporter, "none", "stdout", "file", "otlp"), "tracing.exporter", "must be none, stdout, file or otlp")
+	if c.Tracing.Exporter == "file" {
+		check(c.Tracing.File != "", "tracing.file", "must be provided for the file exporter")
+	}
+	if c.Tracing.Exporter == "otlp" {
+		u, err := url.Parse(c.Tracing.OTLPEndpoint)
+		check(err == nil && u.Scheme != "" && u.Host != "", "tracing.otlp_endpoint", "must be an absolute URL")
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name", "must be provided")
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Diff lists the settings that differ between c and next, split between the
+// ones that can be reloaded and the ones that need a restart.
+func (c *Config) Diff(next *Config) (reloadable, restart []string) {
+	old := fields(reflect.ValueOf(c).Elem(), "")
+	updated := fields(reflect.ValueOf(next).Elem(), "")
+	for i, f := range old {
+		if reflect.DeepEqual(f.value.Interface(), updated[i].value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") == "true" {
+			reloadable = append(reloadable, f.path)
+		} else {
+			restart = append(restart, f.path)
+		}
+	}
+	return reloadable, restart
+}
+
+// Dump renders the configuration as YAML with every secret redacted.
+func (c *Config) Dump() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func validationErrors(t *testing.T, c *Config) Errors {
+	t.Helper()
+	var errs Errors
+	if err := c.Validate(); err != nil && !errors.As(err, &errs) {
+		t.Fatalf("Validate returned %T, want Errors", err)
+	}
+	return errs
+}
+
+func hasError(errs Errors, prefix string) bool {
+	for _, e := range errs {
+		if strings.HasPrefix(e, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateMemoryMailerOnlyInDevelopment(t *testing.T) {
+	for _, env := range []string{"development", "staging", "production"} {
+		c := &Config{Env: env}
+		c.Mailer.Transport = "memory"
+		got := hasError(validationErrors(t, c), "mailer.transport:")
+		if want := env != "development"; got != want {
+			t.Errorf("env %s: mailer.transport rejected = %v, want %v", env, got, want)
+		}
+	}
+}
+
+func TestValidateLimiterWindow(t *testing.T) {
+	tests := []struct {
+		rps   float64
+		burst int
+		want  bool
+	}{
+		{2, 4, false},
+		{2, 1, false},
+		{1000, 1, false},
+		{5000, 1, true},
+	}
+	for _, tt := range tests {
+		c := &Config{}
+		c.Limiter.Enabled = true
+		c.Limiter.RPS = tt.rps
+		c.Limiter.Burst = tt.burst
+		if got := hasError(validationErrors(t, c), "limiter.rps:"); got != tt.want {
+			t.Errorf("rps %v burst %d: limiter.rps rejected = %v, want %v", tt.rps, tt.burst, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors collects every problem found while loading or validating the
+// configuration, so that they can all be fixed in one go.
+type Errors []string
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// field is a settable leaf of Config along with its tags.
+type field struct {
+	path  string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+func fields(v reflect.Value, prefix string) []field {
+	var out []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && !reflect.PtrTo(sf.Type).Implements(textUnmarshalerType) {
+			out = append(out, fields(fv, name)...)
+			continue
+		}
+		out = append(out, field{path: name, value: fv, tag: sf.Tag})
+	}
+	return out
+}
+
+// flagValue records what was given on the command line. Flags are parsed
+// before the config file is read, since the file name is a flag itself, and
+// applied last.
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.raw }
+
+func (f *flagValue) Set(s string) error {
+	f.raw = s
+	f.set = true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// Loader builds the configuration from defaults, the config file named by
+// -config or CONFIG_FILE, the environment and the flags, in increasing
+// precedence. The flags are parsed once, so that a reload re-reads the file
+// while the command line keeps overriding it. The environment is read again
+// too, but a running process only ever sees the one it was started with, so
+// the file is the only source of reloadable changes.
+type Loader struct {
+	configFile *string
+	flags      map[string]*flagValue
+}
+
+// NewLoader registers a flag for every setting on fs. fs must be parsed
+// before Load is called.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		configFile: fs.String("config", os.Getenv("CONFIG_FILE"), "Path of a YAML config file"),
+		flags:      make(map[string]*flagValue),
+	}
+	for _, f := range fields(reflect.ValueOf(&Config{}).Elem(), "") {
+		name := f.tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		fv := &flagValue{raw: f.tag.Get("default"), isBool: f.value.Kind() == reflect.Bool}
+		l.flags[f.path] = fv
+		usage := f.tag.Get("usage")
+		if env := f.tag.Get("env"); env != "" {
+			usage += " [" + env + "]"
+		}
+		fs.Var(fv, name, usage)
+	}
+	return l
+}
+
+// Load builds and validates a new configuration.
+func (l *Loader) Load() (*Config, error) {
+	cfg := &Config{}
+	all := fields(reflect.ValueOf(cfg).Elem(), "")
+
+	var errs Errors
+	for _, f := range all {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := set(f.value, def); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: invalid default %q: %v", f.path, def, err))
+			}
+		}
+	}
+
+	if *l.configFile != "" {
+		b, err := os.ReadFile(*l.configFile)
+		if err != nil {
+			return nil, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			var typeErr *yaml.TypeError
+			if errors.As(err, &typeErr) {
+				for _, e := range typeErr.Errors {
+					errs = append(errs, fmt.Sprintf("%s: %s", *l.configFile, e))
+				}
+			} else {
+				errs = append(errs, fmt.Sprintf("%s: %v", *l.configFile, err))
+			}
+		}
+	}
+
+	for _, f := range all {
+		env := f.tag.Get("env")
+		if env == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(env)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := set(f.value, raw); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: invalid value %q for %s: %v", f.path, raw, env, err))
+		}
+	}
+
+	for _, f := range all {
+		fv, ok := l.flags[f.path]
+		if !ok || !fv.set {
+			continue
+		}
+		if err := set(f.value, fv.raw); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: invalid value %q for -%s: %v", f.path, fv.raw, f.tag.Get("flag"), err))
+		}
+	}
+
+	var invalid Errors
+	if errors.As(cfg.Validate(), &invalid) {
+		errs = append(errs, invalid...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// set parses raw into v according to its type.
+func set(v reflect.Value, raw string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(strings.Fields(strings.ReplaceAll(raw, ",", " "))))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	EmailQueued     = "queued"
+	EmailSent       = "sent"
+	EmailFailed     = "failed"
+	EmailSuppressed = "suppressed"
+	EmailBounced    = "bounced"
+	EmailComplained = "complained"
+)
+
+type Email struct {
+	ID                int64     `json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	Template          string    `json:"template"`
+	Locale            string    `json:"locale"`
+	Recipient         string    `json:"recipient"`
+	Status            string    `json:"status"`
+	Attempts          int       `json:"attempts"`
+	ProviderMessageID string    `json:"provider_message_id,omitempty"`
+	LastError         string    `json:"last_error,omitempty"`
+}
+
+type EmailModel struct {
+	DB DBTX
+}
+
+func (m EmailModel) Insert(ctx context.Context, email *Email) error {
+	query := `
+		INSERT INTO emails (template, locale, recipient, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+	ctx, span := startSpan(ctx, "EmailModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	args := []interface{}{email.Template, email.Locale, email.Recipient, email.Status}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&email.ID, &email.CreatedAt, &email.UpdatedAt)
+}
+
+// RecordAttempt stores the outcome of a delivery attempt. A nil sendErr marks
+// the email as sent with the message ID assigned by the provider.
+func (m EmailModel) RecordAttempt(ctx context.Context, id int64, providerMessageID string, sendErr error) error {
+	status, lastError := EmailSent, ""
+	if sendErr != nil {
+		status, lastError = EmailFailed, sendErr.Error()
+	}
+	query := `
+		UPDATE emails
+		SET status = $2, attempts = attempts + 1, provider_message_id = $3, last_error = $4, updated_at = NOW()
+		WHERE id = $1
+	`
+	ctx, span := startSpan(ctx, "EmailModel.RecordAttempt", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, status, providerMessageID, lastError)
+	return err
+}
+
+func (m EmailModel) SetStatus(ctx context.Context, id int64, status string) error {
+	query := `
+		UPDATE emails
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+	ctx, span := startSpan(ctx, "EmailModel.SetStatus", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, status)
+	return err
+}
+
+// SetStatusForMessage updates the email the provider knows as
+// providerMessageID, returning ErrRecordNotFound when there is none.
+func (m EmailModel) SetStatusForMessage(ctx context.Context, providerMessageID, status string) error {
+	query := `
+		UPDATE emails
+		SET status = $2, updated_at = NOW()
+		WHERE provider_message_id = $1
+	`
+	ctx, span := startSpan(ctx, "EmailModel.SetStatusForMessage", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	r, err := m.DB.ExecContext(ctx, query, providerMessageID, status)
+	if err != nil {
+		return err
+	}
+	rows, err := r.RowsAffected()
+	switch {
+	case err != nil:
+		return err
+	case rows == 0:
+		return ErrRecordNotFound
+	default:
+		return nil
+	}
+}
+
+type SuppressionModel struct {
+	DB DBTX
+}
+
+func (m SuppressionModel) Insert(ctx context.Context, email, reason string) error {
+	query := `
+		INSERT INTO email_suppressions (email, reason)
+		VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET reason = EXCLUDED.reason
+	`
+	ctx, span := startSpan(ctx, "SuppressionModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, email, reason)
+	return err
+}
+
+func (m SuppressionModel) Exists(ctx context.Context, email string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM email_suppressions WHERE email = $1)
+	`
+	ctx, span := startSpan(ctx, "SuppressionModel.Exists", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&exists)
+	return exists, err
+}
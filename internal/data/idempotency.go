@@ -0,0 +1,150 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("idempotency key in use")
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyClaimLost   = errors.New("idempotency key claimed again by another request")
+)
+
+// IdempotentResponse is the first response given to a request with an
+// idempotency key, replayed to the retries of that request.
+type IdempotentResponse struct {
+	Status int
+	Header map[string][]string
+	Body   []byte
+}
+
+type IdempotencyModel struct {
+	DB DBTX
+}
+
+// Begin claims key within scope for the request identified by requestHash,
+// holding it for lock until Complete or Release is called with the same
+// claim. It returns the stored response when the request has already been
+// served, and ErrIdempotencyKeyInUse while another request holds the key.
+// Expired keys are claimed again, so a request outliving its lock may find
+// its claim taken over by a retry.
+func (m IdempotencyModel) Begin(ctx context.Context, scope, key, claim string, requestHash []byte, lock time.Duration) (*IdempotentResponse, error) {
+	query := `
+		INSERT INTO idempotency_keys (scope, key, claim, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + $5::float8 * INTERVAL '1 second')
+		ON CONFLICT (scope, key) DO UPDATE
+		SET claim = EXCLUDED.claim, request_hash = EXCLUDED.request_hash, status = NULL, header = NULL, body = NULL,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING true
+	`
+	ctx, span := startSpan(ctx, "IdempotencyModel.Begin", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var claimed bool
+	err := m.DB.QueryRowContext(ctx, query, scope, key, claim, requestHash, lock.Seconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	query = `
+		SELECT request_hash, status, header, body
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`
+	var storedHash []byte
+	var status sql.NullInt32
+	var header []byte
+	response := &IdempotentResponse{}
+	err = m.DB.QueryRowContext(ctx, query, scope, key).Scan(&storedHash, &status, &header, &response.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrIdempotencyKeyInUse
+		default:
+			return nil, err
+		}
+	}
+	if !bytes.Equal(storedHash, requestHash) {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	if !status.Valid {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	response.Status = int(status.Int32)
+	if err := json.Unmarshal(header, &response.Header); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Complete stores the response to the request holding claim on key, to be
+// replayed until ttl has passed. It returns ErrIdempotencyClaimLost when the
+// key was claimed again in the meantime.
+func (m IdempotencyModel) Complete(ctx context.Context, scope, key, claim string, response *IdempotentResponse, ttl time.Duration) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $4, header = $5, body = $6, expires_at = NOW() + $7::float8 * INTERVAL '1 second'
+		WHERE scope = $1 AND key = $2 AND claim = $3 AND status IS NULL
+	`
+	ctx, span := startSpan(ctx, "IdempotencyModel.Complete", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	res, err := m.DB.ExecContext(ctx, query, scope, key, claim, response.Status, header, response.Body, ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdempotencyClaimLost
+	}
+	return nil
+}
+
+// Release gives up claim on a key without storing a response, so that the
+// request can be retried. A key claimed again since is left alone.
+func (m IdempotencyModel) Release(ctx context.Context, scope, key, claim string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND claim = $3 AND status IS NULL
+	`
+	ctx, span := startSpan(ctx, "IdempotencyModel.Release", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, key, claim)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= NOW()
+	`
+	ctx, span := startSpan(ctx, "IdempotencyModel.DeleteExpired", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	res, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
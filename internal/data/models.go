@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,18 +11,60 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Models struct {
-	Movies     MovieModel
-	Users      UserModel
-	Tokens     TokenModel
-	Permission PermissionModel
+	Movies       MovieModel
+	Users        UserModel
+	Tokens       TokenModel
+	Permission   PermissionModel
+	Outbox       OutboxModel
+	Emails       EmailModel
+	Suppressions SuppressionModel
+	Usage        UsageModel
+	Idempotency  IdempotencyModel
+	db           *sql.DB
 }
 
 func NewModels(db *sql.DB) Models {
+	m := newModels(db)
+	m.db = db
+	return m
+}
+
+func newModels(db DBTX) Models {
 	return Models{
-		Movies:     MovieModel{DB: db},
-		Users:      UserModel{DB: db},
-		Tokens:     TokenModel{DB: db},
-		Permission: PermissionModel{DB: db},
+		Movies:       MovieModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Permission:   PermissionModel{DB: db},
+		Outbox:       OutboxModel{DB: db},
+		Emails:       EmailModel{DB: db},
+		Suppressions: SuppressionModel{DB: db},
+		Usage:        UsageModel{DB: db},
+		Idempotency:  IdempotencyModel{DB: db},
+	}
+}
+
+// Transaction runs fn with a set of models bound to a single transaction,
+// committing when fn returns nil and rolling back otherwise.
+func (m Models) Transaction(ctx context.Context, fn func(tx Models) error) error {
+	if m.db == nil {
+		return errors.New("models are already bound to a transaction")
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(newModels(tx))
+	if err != nil {
+		return err
 	}
+	return tx.Commit()
 }
@@ -40,16 +40,18 @@ func ValidateMovie(v *validator.Validator, m *Movie) {
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
+func (m *MovieModel) Insert(ctx context.Context, movie *Movie) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
 		RETURNING created_at, id, version
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "MovieModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.CreatedAt, &movie.ID, &movie.Version)
@@ -59,7 +61,7 @@ func (m *MovieModel) Insert(movie *Movie) error {
 	return nil
 }
 
-func (m *MovieModel) Get(id int64) (*Movie, error) {
+func (m *MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -69,7 +71,9 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 		FROM movies
 		WHERE id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "MovieModel.Get", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	var movie Movie
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -91,7 +95,7 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m *MovieModel) Update(movie *Movie) error {
+func (m *MovieModel) Update(ctx context.Context, movie *Movie) error {
 	query := `
 		UPDATE movies
 		SET title = $1, runtime = $2, year = $3, genres = $4, version = version + 1
@@ -106,7 +110,9 @@ func (m *MovieModel) Update(movie *Movie) error {
 		movie.ID,
 		movie.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "MovieModel.Update", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
@@ -120,12 +126,14 @@ func (m *MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m *MovieModel) Delete(id int64) error {
+func (m *MovieModel) Delete(ctx context.Context, id int64) error {
 	query := `
 		DELETE FROM movies
 		WHERE id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "MovieModel.Delete", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	r, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
@@ -142,7 +150,7 @@ func (m *MovieModel) Delete(id int64) error {
 	}
 }
 
-func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m *MovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
 		SELECT count(*) OVER(), id, title, year, runtime, created_at, version
 		FROM movies
@@ -154,7 +162,9 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 		`,
 		filters.sortColumn(),
 		filters.sortDirection())
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "MovieModel.GetAll", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	args := []interface{}{
 		title,
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	TopicEmail          = "email"
+	TopicUserRegistered = "user.registered"
+
+	OutboxMaxAttempts = 5
+)
+
+type OutboxEntry struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	AvailableAt time.Time       `json:"available_at"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+type EmailMessage struct {
+	EmailID   int64                  `json:"email_id"`
+	Recipient string                 `json:"recipient"`
+	Locale    string                 `json:"locale"`
+	Template  string                 `json:"template"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type OutboxModel struct {
+	DB DBTX
+}
+
+func NewOutboxEntry(topic string, payload interface{}) (*OutboxEntry, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEntry{Topic: topic, Payload: b}, nil
+}
+
+func (m OutboxModel) Insert(ctx context.Context, entry *OutboxEntry) error {
+	query := `
+		INSERT INTO outbox (topic, payload)
+		VALUES ($1, $2)
+		RETURNING id, created_at, available_at
+	`
+	ctx, span := startSpan(ctx, "OutboxModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, entry.Topic, []byte(entry.Payload)).Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.AvailableAt)
+}
+
+// GetPending locks up to limit undelivered entries. It must be called on
+// models bound to a transaction so that the locks are held until the entries
+// are marked, which keeps concurrent relays from delivering an entry twice.
+func (m OutboxModel) GetPending(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	query := `
+		SELECT id, created_at, topic, payload, attempts, available_at, last_error
+		FROM outbox
+		WHERE processed_at IS NULL AND attempts < $1 AND available_at <= NOW()
+		ORDER BY id ASC
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	ctx, span := startSpan(ctx, "OutboxModel.GetPending", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, OutboxMaxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*OutboxEntry{}
+	for rows.Next() {
+		var entry OutboxEntry
+		var payload []byte
+		err = rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.Topic,
+			&payload,
+			&entry.Attempts,
+			&entry.AvailableAt,
+			&entry.LastError)
+		if err != nil {
+			return nil, err
+		}
+		entry.Payload = payload
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkProcessed records that an entry was delivered. The template data of
+// email entries is dropped, as it may carry secrets such as activation tokens
+// that the tokens table only stores hashed.
+func (m OutboxModel) MarkProcessed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET processed_at = NOW(), attempts = attempts + 1, last_error = '',
+			payload = CASE WHEN topic = $2 THEN payload - 'data' ELSE payload END
+		WHERE id = $1
+	`
+	ctx, span := startSpan(ctx, "OutboxModel.MarkProcessed", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, TopicEmail)
+	return err
+}
+
+// MarkFailed schedules another attempt after retryAfter. Email entries that
+// used up their attempts lose their template data, as in MarkProcessed.
+func (m OutboxModel) MarkFailed(ctx context.Context, id int64, deliveryErr error, retryAfter time.Duration) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, available_at = NOW() + $3 * INTERVAL '1 second',
+			payload = CASE WHEN topic = $4 AND attempts + 1 >= $5 THEN payload - 'data' ELSE payload END
+		WHERE id = $1
+	`
+	ctx, span := startSpan(ctx, "OutboxModel.MarkFailed", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, deliveryErr.Error(), int(retryAfter.Seconds()), TopicEmail, OutboxMaxAttempts)
+	return err
+}
+
+func (m OutboxModel) CountPending(ctx context.Context, topic string) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM outbox
+		WHERE topic = $1 AND processed_at IS NULL AND attempts < $2
+	`
+	ctx, span := startSpan(ctx, "OutboxModel.CountPending", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, topic, OutboxMaxAttempts).Scan(&count)
+	return count, err
+}
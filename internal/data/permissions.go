@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
@@ -14,7 +13,7 @@ type Permission struct {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type Permissions []string
@@ -28,7 +27,7 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 		SELECT p.code
 		FROM users u 
@@ -36,7 +35,9 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 			INNER JOIN permissions p ON p.id = up.permission_id
 		WHERE up.user_id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "PermissionModel.GetAllForUser", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -58,12 +59,14 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, permissions ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, permissions ...string) error {
 	query := `
 		INSERT INTO users_permissions 
 		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "PermissionModel.AddForUser", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	r, err := m.DB.ExecContext(ctx, query, userID, pq.Array(permissions))
 	if err != nil {
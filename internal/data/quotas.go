@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// QuotaTier is the set of limits shared by every user on the tier. A zero
+// DailyLimit means the tier has no daily cap.
+type QuotaTier struct {
+	Name              string `json:"tier"`
+	RequestsPerMinute int    `json:"requests_per_minute"`
+	DailyLimit        int    `json:"daily_limit"`
+}
+
+// Usage reports the requests counted against a user's quota today. Remaining
+// is nil for tiers without a daily cap.
+type Usage struct {
+	QuotaTier
+	Used      int64     `json:"used_today"`
+	Remaining *int64    `json:"remaining_today"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// QuotaResetTime is when the daily counters roll over, at midnight UTC.
+func QuotaResetTime(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+type UsageModel struct {
+	DB DBTX
+}
+
+// Increment counts n requests against the user's daily quota, returning
+// ErrQuotaExceeded without counting any when they do not all fit in what is
+// left of it.
+func (m UsageModel) Increment(ctx context.Context, userID int64, tier QuotaTier, n int) (int64, error) {
+	query := `
+		INSERT INTO user_usage (user_id, day, requests)
+		SELECT $1::bigint, (NOW() AT TIME ZONE 'UTC')::date, $3::integer
+		WHERE $2::integer = 0 OR $3::integer <= $2::integer
+		ON CONFLICT (user_id, day) DO UPDATE SET requests = user_usage.requests + $3::integer
+		WHERE $2::integer = 0 OR user_usage.requests + $3::integer <= $2::integer
+		RETURNING requests
+	`
+	ctx, span := startSpan(ctx, "UsageModel.Increment", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var requests int64
+	err := m.DB.QueryRowContext(ctx, query, userID, tier.DailyLimit, n).Scan(&requests)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrQuotaExceeded
+		default:
+			return 0, err
+		}
+	}
+	return requests, nil
+}
+
+func (m UsageModel) GetForUser(ctx context.Context, user *User) (*Usage, error) {
+	query := `
+		SELECT COALESCE(
+			(SELECT requests FROM user_usage WHERE user_id = $1 AND day = (NOW() AT TIME ZONE 'UTC')::date),
+			0)
+	`
+	ctx, span := startSpan(ctx, "UsageModel.GetForUser", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	usage := &Usage{
+		QuotaTier: user.Quota,
+		ResetsAt:  QuotaResetTime(time.Now()),
+	}
+	err := m.DB.QueryRowContext(ctx, query, user.ID).Scan(&usage.Used)
+	if err != nil {
+		return nil, err
+	}
+	if usage.DailyLimit > 0 {
+		remaining := int64(usage.DailyLimit) - usage.Used
+		if remaining < 0 {
+			remaining = 0
+		}
+		usage.Remaining = &remaining
+	}
+	return usage, nil
+}
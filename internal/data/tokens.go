@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/base32"
 	"time"
 
@@ -25,7 +24,7 @@ type Token struct {
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -51,24 +50,26 @@ func ValidateToken(v *validator.Validator, tokenPlaintext string) {
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
 
-func (m *TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m *TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 	return token, nil
 }
 
-func (m *TokenModel) Insert(token *Token) error {
+func (m *TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
 		INSERT INTO tokens (hash, user_id, expiry, scope)
 		VALUES ($1, $2, $3, $4)
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "TokenModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	args := []interface{}{
 		token.Hash,
@@ -83,12 +84,14 @@ func (m *TokenModel) Insert(token *Token) error {
 	return nil
 }
 
-func (m *TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 		DELETE FROM tokens
 		WHERE user_id = $1 AND scope = $2
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "TokenModel.DeleteAllForUser", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, userID, scope)
 	return err
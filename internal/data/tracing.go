@@ -0,0 +1,16 @@
+package data
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jersonsatoru/lets-go-further/internal/tracing"
+)
+
+// startSpan traces a model method, named after the statement it runs.
+func startSpan(ctx context.Context, name, query string) (context.Context, *tracing.Span) {
+	return tracing.StartKind(ctx, name, tracing.KindClient,
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement.name", name),
+		tracing.String("db.statement", strings.Join(strings.Fields(query), " ")))
+}
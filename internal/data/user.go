@@ -7,6 +7,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/jersonsatoru/lets-go-further/internal/i18n"
 	"github.com/jersonsatoru/lets-go-further/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,6 +21,8 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
+	Quota     QuotaTier `json:"-"`
 	Version   int       `json:"-"`
 }
 
@@ -63,6 +66,7 @@ func ValidateUser(v *validator.Validator, u *User) {
 	v.Check(u.Name != "", "name", "must be greater than 0")
 	v.Check(len(u.Name) <= 500, "name", "must have the maximum of 500 characters")
 	ValidateEmail(v, u.Email)
+	ValidateLocale(v, u.Locale)
 	ValidatePasswordPlaintext(v, *u.Password.plaintext)
 	if u.Password.hash == nil {
 		panic("missing password hash for user")
@@ -74,6 +78,11 @@ func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(validator.Matches(email, validator.EmailRxp), "email", "must be a valid email")
 }
 
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(locale != "", "locale", "must be provided")
+	v.Check(validator.In(locale, i18n.Supported()...), "locale", "must be a supported locale")
+}
+
 func ValidatePasswordPlaintext(v *validator.Validator, plaintextPassword string) {
 	v.Check(plaintextPassword != "", "password", "must not be empty")
 	v.Check(len(plaintextPassword) >= 8, "password", "must greater than 8")
@@ -81,22 +90,25 @@ func ValidatePasswordPlaintext(v *validator.Validator, plaintextPassword string)
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (m *UserModel) Insert(user *User) error {
+func (m *UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, activated, locale)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING created_at, version, id
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "UserModel.Insert", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
-		user.Activated}
+		user.Activated,
+		user.Locale}
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.CreatedAt, &user.Version, &user.ID)
 	if err != nil {
@@ -110,13 +122,15 @@ func (m *UserModel) Insert(user *User) error {
 	return nil
 }
 
-func (m *UserModel) GetByEmail(email string) (*User, error) {
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, name, email, activated, version, created_at, password_hash
+		SELECT id, name, email, activated, locale, version, created_at, password_hash
 		FROM users
 		WHERE email = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "UserModel.GetByEmail", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	var user User
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
@@ -124,6 +138,7 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 		&user.Name,
 		&user.Email,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 		&user.CreatedAt,
 		&user.Password.hash)
@@ -138,20 +153,23 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (m *UserModel) Update(user *User) error {
+func (m *UserModel) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, activated = $3, password_hash = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, activated = $3, password_hash = $4, locale = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "UserModel.Update", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	args := []interface{}{
 		&user.Name,
 		&user.Email,
 		&user.Activated,
 		&user.Password.hash,
+		&user.Locale,
 		&user.ID,
 		&user.Version,
 	}
@@ -169,13 +187,57 @@ func (m *UserModel) Update(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetForToken(plaintextToken, tokenScope string) (*User, error) {
+// GetForCertificate returns the user that a client certificate subject was
+// issued to, for internal callers authenticating with mTLS.
+func (m UserModel) GetForCertificate(ctx context.Context, subject string) (*User, error) {
+	query := `
+		SELECT u.id, u.name, u.email, u.activated, u.locale, u.created_at, u.version, u.password_hash,
+			q.name, q.requests_per_minute, q.daily_limit
+		FROM users u
+			INNER JOIN client_certificates c ON (u.id = c.user_id)
+			INNER JOIN quota_tiers q ON (q.name = u.tier)
+		WHERE c.subject = $1
+	`
+	ctx, span := startSpan(ctx, "UserModel.GetForCertificate", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, subject).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Locale,
+		&user.CreatedAt,
+		&user.Version,
+		&user.Password.hash,
+		&user.Quota.Name,
+		&user.Quota.RequestsPerMinute,
+		&user.Quota.DailyLimit)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (m UserModel) GetForToken(ctx context.Context, plaintextToken, tokenScope string) (*User, error) {
 	query := `
-		SELECT u.id, u.name, u.email, u.activated, u.created_at, u.version, u.password_hash
-		FROM users u INNER JOIN tokens t ON (u.id = t.user_id)
+		SELECT u.id, u.name, u.email, u.activated, u.locale, u.created_at, u.version, u.password_hash,
+			q.name, q.requests_per_minute, q.daily_limit
+		FROM users u
+			INNER JOIN tokens t ON (u.id = t.user_id)
+			INNER JOIN quota_tiers q ON (q.name = u.tier)
 		WHERE t.hash = $1 AND NOW() < t.expiry AND t.scope = $2
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, span := startSpan(ctx, "UserModel.GetForToken", query)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	hash := sha256.Sum256([]byte(plaintextToken))
 	var user User
@@ -184,9 +246,13 @@ func (m UserModel) GetForToken(plaintextToken, tokenScope string) (*User, error)
 		&user.Name,
 		&user.Email,
 		&user.Activated,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.Version,
-		&user.Password.hash)
+		&user.Password.hash,
+		&user.Quota.Name,
+		&user.Quota.RequestsPerMinute,
+		&user.Quota.DailyLimit)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
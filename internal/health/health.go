@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// CheckFunc probes a single dependency. The returned details are reported
+// alongside the check's status, also when the check fails.
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+type Result struct {
+	Status   string                 `json:"status"`
+	Duration float64                `json:"duration_ms"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the registered checks concurrently and caches the report for
+// ttl, so that frequent probes from load balancers do not reach the
+// dependencies on every call.
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	checks  []check
+	report  *Report
+	expires time.Time
+}
+
+func New(ttl, timeout time.Duration) *Checker {
+	return &Checker{ttl: ttl, timeout: timeout}
+}
+
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+	c.report = nil
+}
+
+// Run returns the cached report when it is still fresh and runs every check
+// otherwise. Concurrent callers wait for a single run.
+func (c *Checker) Run() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.report != nil && time.Now().Before(c.expires) {
+		return *c.report
+	}
+
+	report := Report{
+		Status:    StatusOK,
+		CheckedAt: time.Now().UTC(),
+		Checks:    make(map[string]Result, len(c.checks)),
+	}
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = c.run(ch)
+		}(i, ch)
+	}
+	wg.Wait()
+	for i, ch := range c.checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	c.report = &report
+	c.expires = time.Now().Add(c.ttl)
+	return report
+}
+
+// run detaches the check from the caller's request, so that a client going
+// away does not cache a failure for everybody else.
+func (c *Checker) run(ch check) (res Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			res = Result{Status: StatusFailing, Error: "check panicked"}
+		}
+		res.Duration = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	details, err := ch.fn(ctx)
+	res = Result{Status: StatusOK, Details: details}
+	if err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+	return res
+}
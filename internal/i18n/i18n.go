@@ -0,0 +1,250 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultLocale = "en"
+
+//go:embed "locales"
+var localesFS embed.FS
+
+var (
+	catalogs     = loadCatalogs()
+	textPatterns = compileTextPatterns()
+)
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]map[string]string)
+	for _, entry := range entries {
+		b, err := localesFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		messages := make(map[string]string)
+		err = json.Unmarshal(b, &messages)
+		if err != nil {
+			panic(fmt.Sprintf("locales/%s: %v", entry.Name(), err))
+		}
+		catalogs[Normalize(strings.TrimSuffix(entry.Name(), ".json"))] = messages
+	}
+	if _, ok := catalogs[DefaultLocale]; !ok {
+		panic("missing catalog for default locale " + DefaultLocale)
+	}
+	return catalogs
+}
+
+func Supported() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func IsSupported(locale string) bool {
+	_, ok := catalogs[Normalize(locale)]
+	return ok
+}
+
+// Normalize turns a language tag such as "pt_br" into its canonical "pt-BR"
+// form.
+func Normalize(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Fallbacks lists the locales to try, in order, for locale: the locale
+// itself, its base language and finally the default locale.
+func Fallbacks(locale string) []string {
+	locale = Normalize(locale)
+	fallbacks := []string{}
+	for locale != "" {
+		fallbacks = append(fallbacks, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if len(fallbacks) == 0 || fallbacks[len(fallbacks)-1] != DefaultLocale {
+		fallbacks = append(fallbacks, DefaultLocale)
+	}
+	return fallbacks
+}
+
+// Match picks the best supported locale for an Accept-Language header,
+// returning the default locale when nothing matches.
+func Match(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	candidates := []candidate{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" || fields[0] == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{locale: fields[0], q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		locale := Normalize(c.locale)
+		if IsSupported(locale) {
+			return locale
+		}
+		base := strings.Split(locale, "-")[0]
+		if IsSupported(base) {
+			return base
+		}
+		for _, supported := range Supported() {
+			if strings.HasPrefix(supported, base+"-") {
+				return supported
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+// Translate formats the message for key in locale, which must be a supported
+// locale such as the one returned by Match, falling back to its base language
+// and the default locale.
+func Translate(locale, key string, args ...interface{}) string {
+	for _, l := range Fallbacks(locale) {
+		if message, ok := catalogs[l][key]; ok {
+			if len(args) > 0 {
+				return fmt.Sprintf(message, args...)
+			}
+			return message
+		}
+	}
+	return key
+}
+
+// textPrefix marks the catalog entries translating text the code produces in
+// English, such as validation reasons. The rest of such a key is the English
+// text, where %d stands for an integer and %s or %v for anything else. English
+// text is its own translation, so only the other catalogs carry these entries.
+const textPrefix = "text."
+
+type textPattern struct {
+	key   string
+	verbs []string
+	rx    *regexp.Regexp
+}
+
+var textVerbRx = regexp.MustCompile(`%[dsv]`)
+
+func compileTextPatterns() []textPattern {
+	keys := make(map[string]bool)
+	for _, messages := range catalogs {
+		for key := range messages {
+			if strings.HasPrefix(key, textPrefix) && textVerbRx.MatchString(key) {
+				keys[key] = true
+			}
+		}
+	}
+	patterns := make([]textPattern, 0, len(keys))
+	for key := range keys {
+		text := strings.TrimPrefix(key, textPrefix)
+		literals := textVerbRx.Split(text, -1)
+		verbs := textVerbRx.FindAllString(text, -1)
+		expr := "^" + regexp.QuoteMeta(literals[0])
+		for i, verb := range verbs {
+			if verb == "%d" {
+				expr += `(-?\d+)`
+			} else {
+				expr += "(.+)"
+			}
+			expr += regexp.QuoteMeta(literals[i+1])
+		}
+		patterns = append(patterns, textPattern{key: key, verbs: verbs, rx: regexp.MustCompile(expr + "$")})
+	}
+	// The longest key is the most specific, try it first.
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i].key) != len(patterns[j].key) {
+			return len(patterns[i].key) > len(patterns[j].key)
+		}
+		return patterns[i].key < patterns[j].key
+	})
+	return patterns
+}
+
+// TranslateText translates text produced in English by the code, such as
+// "must be at least 3 bytes long", through the text entries of the catalogs.
+// Text without a translation is returned as is.
+func TranslateText(locale, text string) string {
+	key := textPrefix + text
+	var args []interface{}
+	if !hasMessage(key) {
+		for _, p := range textPatterns {
+			match := p.rx.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			key = p.key
+			for i, verb := range p.verbs {
+				arg := interface{}(match[i+1])
+				if n, err := strconv.ParseInt(match[i+1], 10, 64); verb == "%d" && err == nil {
+					arg = n
+				}
+				args = append(args, arg)
+			}
+			break
+		}
+	}
+	for _, l := range Fallbacks(locale) {
+		if l == DefaultLocale {
+			break
+		}
+		if message, ok := catalogs[l][key]; ok {
+			if len(args) > 0 {
+				return fmt.Sprintf(message, args...)
+			}
+			return message
+		}
+	}
+	return text
+}
+
+func hasMessage(key string) bool {
+	for _, messages := range catalogs {
+		if _, ok := messages[key]; ok {
+			return true
+		}
+	}
+	return false
+}
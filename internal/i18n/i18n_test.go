@@ -0,0 +1,45 @@
+package i18n
+
+import "testing"
+
+func TestTranslateLooksUpTheLocaleDirectly(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"pt-BR", "token inválido"},
+		{"en", "invalid token"},
+		{"fr", "invalid token"},
+		// A stored locale is not an Accept-Language header: a quality value
+		// would have been parsed by Match, here it makes the lookup fail.
+		{"pt-BR;q=0.5", "invalid token"},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.locale, "error.invalid_token"); got != tt.want {
+			t.Errorf("Translate(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateText(t *testing.T) {
+	tests := []struct {
+		locale string
+		text   string
+		want   string
+	}{
+		{"pt-BR", "must be provided", "deve ser informado"},
+		{"pt-BR", "must be at least 3 bytes long", "deve ter pelo menos 3 bytes"},
+		{"pt-BR", "must be greater than or equal to 1888", "deve ser maior ou igual a 1888"},
+		{"pt-BR", "must be greater than zero", "deve ser maior que zero"},
+		{"pt-BR", "must be one of v1, v2", "deve ser um de v1, v2"},
+		{"pt-BR", "body contains badly-formed JSON (at character 12)", "o corpo contém JSON malformado (no caractere 12)"},
+		{"pt-BR", "replace /title: path does not exist", "replace /title: o caminho não existe"},
+		{"pt-BR", "not a known reason", "not a known reason"},
+		{"en", "must be at least 3 bytes long", "must be at least 3 bytes long"},
+	}
+	for _, tt := range tests {
+		if got := TranslateText(tt.locale, tt.text); got != tt.want {
+			t.Errorf("TranslateText(%q, %q) = %q, want %q", tt.locale, tt.text, got, tt.want)
+		}
+	}
+}
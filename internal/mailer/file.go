@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into dir, which is handy
+// for local development where no SMTP server is available.
+type FileMailer struct {
+	dir    string
+	sender string
+}
+
+func NewFile(dir, sender string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{
+		dir:    dir,
+		sender: sender,
+	}, nil
+}
+
+func (m *FileMailer) Send(recipient, locale, templateFile string, data interface{}) (string, error) {
+	msg, err := render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(recipient))
+	f, err := os.Create(filepath.Join(m.dir, name))
+	if err != nil {
+		return "", err
+	}
+	_, err = msg.mail().WriteTo(f)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+	return msg.ID, f.Close()
+}
@@ -2,62 +2,197 @@ package mailer
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"html/template"
-	"time"
+	"io/fs"
+	netmail "net/mail"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-mail/mail/v2"
+	"github.com/jersonsatoru/lets-go-further/internal/i18n"
 )
 
 //go:embed "templates"
 var templatesFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+var ErrTemplateNotFound = errors.New("template not found")
+
+var templateErrorRxp = regexp.MustCompile(`^template: [^:]+:(\d+)(?::\d+)?: (.*)$`)
+
+// Mailer renders and delivers a template, returning the Message-ID the email
+// was sent with so that provider notifications can be matched to it later.
+type Mailer interface {
+	Send(recipient, locale, templateFile string, data interface{}) (string, error)
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
+// Pinger is implemented by transports that depend on a remote server and can
+// check that it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Message struct {
+	ID        string
+	From      string
+	To        string
+	Locale    string
+	Subject   string
+	Plaintext string
+	HTMLBody  string
+}
+
+type Template struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+// TemplateError describes a failure to parse or execute one of the blocks of
+// an email template.
+type TemplateError struct {
+	Template string `json:"template"`
+	Locale   string `json:"locale"`
+	Block    string `json:"block,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("%s/%s: %s", e.Locale, e.Template, e.Message)
+}
+
+func newTemplateError(locale, templateFile, block string, err error) *TemplateError {
+	te := &TemplateError{
+		Template: templateFile,
+		Locale:   locale,
+		Block:    block,
+		Message:  err.Error(),
+	}
+	if m := templateErrorRxp.FindStringSubmatch(err.Error()); m != nil {
+		te.Line, _ = strconv.Atoi(m[1])
+		te.Message = m[2]
 	}
+	return te
 }
-func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
-	tmpl, err := template.New("email").ParseFS(templatesFS, "templates/"+templateFile)
+
+// Templates lists the embedded templates together with the locales each one
+// is translated to.
+func Templates() ([]Template, error) {
+	locales, err := templatesFS.ReadDir("templates")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	byName := make(map[string][]string)
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		files, err := templatesFS.ReadDir(path.Join("templates", locale.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			byName[file.Name()] = append(byName[file.Name()], locale.Name())
+		}
 	}
+	templates := make([]Template, 0, len(byName))
+	for name, locales := range byName {
+		templates = append(templates, Template{Name: name, Locales: locales})
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
+// templateLocale returns the translation of templateFile that best matches
+// locale, falling back to the base language and then to the default locale.
+func templateLocale(locale, templateFile string) (string, error) {
+	for _, l := range i18n.Fallbacks(locale) {
+		if _, err := fs.Stat(templatesFS, path.Join("templates", l, templateFile)); err == nil {
+			return l, nil
+		}
 	}
+	return "", fmt.Errorf("%w: %q for locale %q", ErrTemplateNotFound, templateFile, locale)
+}
 
-	plaintext := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plaintext, "plaintext", data)
+// Render executes the subject, plaintext and htmlBody blocks of templateFile
+// without sending anything. Parse and execution failures are returned as a
+// *TemplateError.
+func Render(locale, templateFile string, data interface{}) (*Message, error) {
+	l, err := templateLocale(locale, templateFile)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("email").ParseFS(templatesFS, path.Join("templates", l, templateFile))
 	if err != nil {
-		return err
+		return nil, newTemplateError(l, templateFile, "", err)
 	}
 
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	msg := &Message{Locale: l}
+	blocks := []struct {
+		name string
+		dst  *string
+	}{
+		{"subject", &msg.Subject},
+		{"plaintext", &msg.Plaintext},
+		{"htmlBody", &msg.HTMLBody},
+	}
+	for _, block := range blocks {
+		buf := new(bytes.Buffer)
+		err = tmpl.ExecuteTemplate(buf, block.name, data)
+		if err != nil {
+			return nil, newTemplateError(l, templateFile, block.name, err)
+		}
+		*block.dst = buf.String()
+	}
+	return msg, nil
+}
+
+func render(sender, recipient, locale, templateFile string, data interface{}) (*Message, error) {
+	msg, err := Render(locale, templateFile, data)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	msg.From = sender
+	msg.To = recipient
+	msg.ID, err = newMessageID(sender)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plaintext.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-	err = m.dialer.DialAndSend(msg)
+func newMessageID(sender string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	domain := "localhost"
+	if addr, err := netmail.ParseAddress(sender); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+func (m *Message) mail() *mail.Message {
+	msg := mail.NewMessage()
+	msg.SetHeader("Message-ID", m.ID)
+	msg.SetHeader("To", m.To)
+	msg.SetHeader("From", m.From)
+	msg.SetHeader("Subject", m.Subject)
+	msg.SetBody("text/plain", m.Plaintext)
+	msg.AddAlternative("text/html", m.HTMLBody)
+	return msg
 }
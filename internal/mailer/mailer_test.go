@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var welcomeData = map[string]interface{}{
+	"userID":          42,
+	"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+}
+
+func TestMemoryMailerCapturesMessages(t *testing.T) {
+	m := NewMemory("Greenlight <no-reply@greenlight.test>")
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "en"},
+		{"pt-BR", "pt-BR"},
+		{"fr-CA", "en"},
+	}
+	for _, tt := range tests {
+		id, err := m.Send("alice@example.com", tt.locale, "user_welcome.tmpl", welcomeData)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.locale, err)
+		}
+		if !strings.HasSuffix(id, "@greenlight.test>") {
+			t.Errorf("%s: message ID %q does not use the sender domain", tt.locale, id)
+		}
+	}
+
+	messages := m.Messages()
+	if len(messages) != len(tests) {
+		t.Fatalf("captured %d messages, want %d", len(messages), len(tests))
+	}
+	for i, msg := range messages {
+		if msg.Locale != tests[i].want {
+			t.Errorf("message %d: locale %q, want %q", i, msg.Locale, tests[i].want)
+		}
+		if msg.To != "alice@example.com" {
+			t.Errorf("message %d: recipient %q", i, msg.To)
+		}
+		if !strings.Contains(msg.Plaintext, "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU") {
+			t.Errorf("message %d: plaintext does not contain the activation token", i)
+		}
+	}
+
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("Reset kept messages")
+	}
+}
+
+func TestMemoryMailerUnknownTemplate(t *testing.T) {
+	m := NewMemory("no-reply@greenlight.test")
+	if _, err := m.Send("alice@example.com", "en", "missing.tmpl", nil); err == nil {
+		t.Fatal("sending a missing template succeeded")
+	}
+	if len(m.Messages()) != 0 {
+		t.Error("a failed send was captured")
+	}
+}
+
+func TestLogMailerDoesNotLogTheBody(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	id, err := NewLog("no-reply@greenlight.test").Send("alice@example.com", "en", "user_welcome.tmpl", welcomeData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["messageID"] != id || fields["to"] != "alice@example.com" || fields["template"] != "user_welcome.tmpl" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	for name, value := range fields {
+		if s, ok := value.(string); ok && strings.Contains(s, "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU") {
+			t.Errorf("field %s leaks the activation token", name)
+		}
+	}
+}
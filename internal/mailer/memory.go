@@ -0,0 +1,39 @@
+package mailer
+
+import "sync"
+
+// MemoryMailer keeps sent messages in memory so that tests can inspect them.
+type MemoryMailer struct {
+	sender   string
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewMemory(sender string) *MemoryMailer {
+	return &MemoryMailer{sender: sender}
+}
+
+func (m *MemoryMailer) Send(recipient, locale, templateFile string, data interface{}) (string, error) {
+	msg, err := render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return msg.ID, nil
+}
+
+func (m *MemoryMailer) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]*Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
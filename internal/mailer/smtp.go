@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+type SMTPMailer struct {
+	dialer *mail.Dialer
+	sender string
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+	return &SMTPMailer{
+		dialer: dialer,
+		sender: sender,
+	}
+}
+
+func (m *SMTPMailer) Send(recipient, locale, templateFile string, data interface{}) (string, error) {
+	msg, err := render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return "", err
+	}
+	err = m.dialer.DialAndSend(msg.mail())
+	if err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+// Ping checks that the SMTP server accepts connections and greets us,
+// without authenticating or sending anything.
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	addr := net.JoinHostPort(m.dialer.Host, strconv.Itoa(m.dialer.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, m.dialer.Host)
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
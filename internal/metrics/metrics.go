@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		r.WritePrometheus(bw)
+		bw.Flush()
+	})
+}
+
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hist := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(key, "le", formatFloat(upper)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, hist.count)
+	}
+}
+
+// Gauge reports the last value it was set to.
+type Gauge struct {
+	name  string
+	help  string
+	mu    sync.Mutex
+	value float64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	v := g.value
+	g.mu.Unlock()
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(v))
+}
+
+// GaugeFunc reports the value returned by fn at scrape time.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// labelKey renders the label set as it appears in the exposition format, so
+// it can double as the map key for the series.
+func labelKey(labels, values []string) string {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(labels), len(values)))
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, label, labelValueReplacer.Replace(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func withLabel(key, label, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, label, value)
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return key[:len(key)-1] + "," + pair + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,264 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// lockID is the key of the advisory lock held while migrating, so that
+// replicas starting together do not apply the same migration twice.
+const lockID = 7_366_353_152_915_262_002
+
+var (
+	ErrDirty      = errors.New("database schema is dirty, fix the failed migration and force its version")
+	ErrNoChange   = errors.New("no migration to apply")
+	fileNameRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// setupFile holds the statements that migrations rely on but cannot create
+// themselves, such as extensions needed by an early migration. They must be
+// safe to run again.
+const setupFile = "setup.sql"
+
+// Migrator applies migrations the way the migrate CLI does, keeping the
+// current version in the schema_migrations table, so databases migrated by
+// either tool can be handled by the other.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	setup      string
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	setup, err := fs.ReadFile(fsys, setupFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, setup: string(setup)}, nil
+}
+
+// Load reads NNNNNN_name.up.sql and NNNNNN_name.down.sql files from the root
+// of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileNameRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest is the version the code expects the schema to be at.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the current schema version, which is 0 for a database that
+// was never migrated.
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return version(ctx, m.db)
+}
+
+// Up applies every pending migration and returns how many were applied. The
+// setup file runs first whenever a migration is pending.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if applied == 0 && m.setup != "" {
+				_, err = conn.ExecContext(ctx, m.setup)
+				if err != nil {
+					return fmt.Errorf("%s: %w", setupFile, err)
+				}
+			}
+			err = apply(ctx, conn, migration.Up, migration.Version, fmt.Sprintf("%d_%s.up", migration.Version, migration.Name))
+			if err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	if err == nil && applied == 0 {
+		err = ErrNoChange
+	}
+	return applied, err
+}
+
+// Down rolls back the last steps migrations and returns how many were rolled
+// back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	rolledBack := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && rolledBack < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			err = apply(ctx, conn, migration.Down, previous, fmt.Sprintf("%d_%s.down", migration.Version, migration.Name))
+			if err != nil {
+				return err
+			}
+			rolledBack++
+		}
+		return nil
+	})
+	if err == nil && rolledBack == 0 {
+		err = ErrNoChange
+	}
+	return rolledBack, err
+}
+
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, int64(lockID))
+	if err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, int64(lockID))
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) current(ctx context.Context, conn *sql.Conn) (int64, error) {
+	current, dirty, err := version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, ErrDirty
+	}
+	return current, nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func version(ctx context.Context, db queryer) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		case errors.As(err, &pqErr) && pqErr.Code == "42P01":
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return version, dirty, nil
+}
+
+// apply runs a migration file and records the resulting version in the same
+// transaction. Should the migration fail halfway, nothing is kept and the
+// schema stays clean.
+func apply(ctx context.Context, conn *sql.Conn, query string, to int64, name string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if query != "" {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, `TRUNCATE schema_migrations`)
+	if err != nil {
+		return err
+	}
+	if to > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, to)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,217 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a ()")},
+	"000001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b ()")},
+	"000002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	"000010_create_c.up.sql":   {Data: []byte("CREATE TABLE c ()")},
+	"000010_create_c.down.sql": {Data: []byte("DROP TABLE c")},
+	"README.md":                {Data: []byte("not a migration")},
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	m, err := New(db, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, mock
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+		WithArgs(int64(lockID)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+		WithArgs(int64(lockID)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectVersion(mock sqlmock.Sqlmock, version int64, dirty bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, dirty FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(version, dirty))
+}
+
+func expectApply(mock sqlmock.Sqlmock, query string, to int64) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("TRUNCATE schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	if to > 0 {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).
+			WithArgs(to).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestLoadSortsMigrationsByVersion(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if len(versions) != 3 || versions[0] != 1 || versions[1] != 2 || versions[2] != 10 {
+		t.Errorf("versions = %v, want [1 2 10]", versions)
+	}
+}
+
+func TestUpAppliesPendingMigrationsInOrderUnderTheLock(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectVersion(mock, 1, false)
+	expectApply(mock, "CREATE TABLE b ()", 2)
+	expectApply(mock, "CREATE TABLE c ()", 10)
+	expectUnlock(mock)
+
+	n, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("applied %d migrations, want 2", n)
+	}
+}
+
+func TestSetupRunsBeforeTheFirstPendingMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fsys := fstest.MapFS{
+		"setup.sql":              {Data: []byte("CREATE EXTENSION IF NOT EXISTS citext")},
+		"000001_create_a.up.sql": {Data: []byte("CREATE TABLE a (email citext)")},
+		"000002_create_b.up.sql": {Data: []byte("CREATE TABLE b ()")},
+	}
+	m, err := New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectLock(mock)
+	expectVersion(mock, 0, false)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE EXTENSION IF NOT EXISTS citext")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectApply(mock, "CREATE TABLE a (email citext)", 1)
+	expectApply(mock, "CREATE TABLE b ()", 2)
+	expectUnlock(mock)
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectLock(mock)
+	expectVersion(mock, 2, false)
+	expectUnlock(mock)
+	if _, err := m.Up(context.Background()); !errors.Is(err, ErrNoChange) {
+		t.Fatalf("got error %v, want %v", err, ErrNoChange)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpReportsNoChange(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectVersion(mock, 10, false)
+	expectUnlock(mock)
+
+	if _, err := m.Up(context.Background()); !errors.Is(err, ErrNoChange) {
+		t.Fatalf("got error %v, want %v", err, ErrNoChange)
+	}
+}
+
+func TestDownRollsBackInReverseOrder(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectVersion(mock, 10, false)
+	expectApply(mock, "DROP TABLE c", 2)
+	expectApply(mock, "DROP TABLE b", 1)
+	expectUnlock(mock)
+
+	n, err := m.Down(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("rolled back %d migrations, want 2", n)
+	}
+}
+
+func TestDownToAnEmptySchema(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectVersion(mock, 1, false)
+	expectApply(mock, "DROP TABLE a", 0)
+	expectUnlock(mock)
+
+	if _, err := m.Down(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirtySchemaIsNotMigrated(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectVersion(mock, 2, true)
+	expectUnlock(mock)
+
+	if _, err := m.Up(context.Background()); !errors.Is(err, ErrDirty) {
+		t.Fatalf("got error %v, want %v", err, ErrDirty)
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	failure := errors.New("syntax error")
+	expectLock(mock)
+	expectVersion(mock, 1, false)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b ()")).WillReturnError(failure)
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	if _, err := m.Up(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("got error %v, want %v", err, failure)
+	}
+}
+
+func TestNothingRunsWithoutTheLock(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	failure := errors.New("canceling statement due to lock timeout")
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+		WithArgs(int64(lockID)).
+		WillReturnError(failure)
+
+	if _, err := m.Up(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("got error %v, want %v", err, failure)
+	}
+}
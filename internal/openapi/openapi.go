@@ -0,0 +1,98 @@
+// Package openapi describes an HTTP API as an OpenAPI 3 document, deriving
+// the schemas of request and response bodies from Go types.
+package openapi
+
+import (
+	"regexp"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case HTTP methods to the operation they perform.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Permission  string                `json:"x-permission,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation returns the operation for method, or nil when the path does not
+// support it.
+func (p PathItem) Operation(method string) *Operation {
+	return p[strings.ToLower(method)]
+}
+
+var templateVarRxp = regexp.MustCompile(`\{([^{}:]+)(?::([^{}]+))?\}`)
+
+// PathFromTemplate turns a gorilla/mux path template such as
+// /v1/movies/{id:[0-9]+} into an OpenAPI path and its path parameters, the
+// variable patterns becoming the parameter patterns.
+func PathFromTemplate(template string) (string, []Parameter) {
+	var params []Parameter
+	path := templateVarRxp.ReplaceAllStringFunc(template, func(v string) string {
+		m := templateVarRxp.FindStringSubmatch(v)
+		schema := &Schema{Type: "string"}
+		if m[2] != "" {
+			schema.Pattern = "^" + m[2] + "$"
+		}
+		params = append(params, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+		return "{" + m[1] + "}"
+	})
+	return path, params
+}
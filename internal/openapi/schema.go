@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Generator derives schemas from Go types. Exported named struct types are
+// added to Schemas once and referenced from then on.
+//
+// Struct fields may narrow their schema with a validate tag holding a comma
+// separated list of constraints: required, nullable, unique, min=N, max=N,
+// minLength=N, maxLength=N, minItems=N, maxItems=N, format=F, pattern=P and
+// enum=a|b.
+type Generator struct {
+	Schemas   map[string]*Schema
+	overrides map[reflect.Type]*Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		Schemas: make(map[string]*Schema),
+		overrides: map[reflect.Type]*Schema{
+			reflect.TypeOf(time.Time{}):       {Type: "string", Format: "date-time"},
+			reflect.TypeOf(json.RawMessage{}): {},
+		},
+	}
+}
+
+// Override describes the type of v with s instead of deriving it, for types
+// with their own JSON encoding.
+func (g *Generator) Override(v interface{}, s Schema) {
+	g.overrides[reflect.TypeOf(v)] = &s
+}
+
+// Schema returns the schema of the JSON encoding of v.
+func (g *Generator) Schema(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if s, ok := g.overrides[t]; ok {
+		copied := *s
+		return &copied
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" || t.PkgPath() == "" || !isExported(name) {
+			return g.object(t)
+		}
+		if _, ok := g.Schemas[name]; !ok {
+			g.Schemas[name] = &Schema{}
+			g.Schemas[name] = g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (g *Generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *Generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := g.schema(f.Type)
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			if constrain(prop, tag) {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// constrain applies the constraints of a validate tag to s and reports
+// whether the field is required.
+func constrain(s *Schema, tag string) bool {
+	required := false
+	for _, c := range strings.Split(tag, ",") {
+		key, value := c, ""
+		if i := strings.Index(c, "="); i >= 0 {
+			key, value = c[:i], c[i+1:]
+		}
+		switch key {
+		case "required":
+			required = true
+		case "nullable":
+			s.Nullable = true
+		case "unique":
+			s.UniqueItems = true
+		case "min", "max":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				panic("openapi: invalid validate tag " + tag)
+			}
+			if key == "min" {
+				s.Minimum = &f
+			} else {
+				s.Maximum = &f
+			}
+		case "minLength", "maxLength", "minItems", "maxItems":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic("openapi: invalid validate tag " + tag)
+			}
+			switch key {
+			case "minLength":
+				s.MinLength = &n
+			case "maxLength":
+				s.MaxLength = &n
+			case "minItems":
+				s.MinItems = &n
+			default:
+				s.MaxItems = &n
+			}
+		case "format":
+			s.Format = value
+		case "pattern":
+			s.Pattern = value
+		case "enum":
+			s.Enum = strings.Split(value, "|")
+		default:
+			panic("openapi: unknown constraint " + key)
+		}
+	}
+	return required
+}
+
+func isExported(name string) bool {
+	return name[0] >= 'A' && name[0] <= 'Z'
+}
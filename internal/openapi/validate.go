@@ -0,0 +1,216 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jersonsatoru/lets-go-further/internal/validator"
+)
+
+// Validate checks value, as decoded by encoding/json into an interface{},
+// against s. The reason each invalid field fails is recorded in errs, keyed
+// by its path below field; a failing root value is recorded under "body".
+func (d *Document) Validate(s *Schema, value interface{}, field string, errs map[string]string) {
+	s = d.resolve(s)
+	name := field
+	if name == "" {
+		name = "body"
+	}
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			errs[name] = "must not be null"
+		}
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if !typeIs(s, "string") {
+			break
+		}
+		if reason := checkString(s, v); reason != "" {
+			errs[name] = reason
+		}
+		return
+	case bool:
+		if typeIs(s, "boolean") {
+			return
+		}
+	case float64:
+		if !typeIs(s, "number", "integer") {
+			break
+		}
+		if reason := checkNumber(s, v); reason != "" {
+			errs[name] = reason
+		}
+		return
+	case []interface{}:
+		if !typeIs(s, "array") {
+			break
+		}
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			errs[name] = fmt.Sprintf("must contain at least %d items", *s.MinItems)
+			return
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			errs[name] = fmt.Sprintf("must not contain more than %d items", *s.MaxItems)
+			return
+		}
+		if s.UniqueItems && !unique(v) {
+			errs[name] = "must not contain duplicate values"
+			return
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				d.Validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i), errs)
+			}
+		}
+		return
+	case map[string]interface{}:
+		if !typeIs(s, "object") {
+			break
+		}
+		for _, required := range s.Required {
+			if _, ok := v[required]; !ok {
+				errs[join(field, required)] = "must be provided"
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := s.Properties[key]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if prop != nil {
+				d.Validate(prop, v[key], join(field, key), errs)
+			}
+		}
+		return
+	}
+	errs[name] = "must be " + typeName(s.Type)
+}
+
+// ValidateParameter checks the raw value of a path or query parameter and
+// returns why it is invalid, or "" when it is valid.
+func (d *Document) ValidateParameter(p Parameter, raw string) string {
+	s := d.resolve(p.Schema)
+	switch s.Type {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "must be " + typeName(s.Type)
+		}
+		return checkNumber(s, f)
+	case "boolean":
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return "must be a boolean"
+		}
+		return ""
+	}
+	return checkString(s, raw)
+}
+
+func (d *Document) resolve(s *Schema) *Schema {
+	if s.Ref == "" {
+		return s
+	}
+	resolved, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	if !ok {
+		panic("openapi: unknown reference " + s.Ref)
+	}
+	return resolved
+}
+
+func checkString(s *Schema, v string) string {
+	switch {
+	case s.MinLength != nil && len(v) < *s.MinLength:
+		if *s.MinLength == 1 {
+			return "must be provided"
+		}
+		return fmt.Sprintf("must be at least %d bytes long", *s.MinLength)
+	case s.MaxLength != nil && len(v) > *s.MaxLength:
+		return fmt.Sprintf("must not be more than %d bytes long", *s.MaxLength)
+	case len(s.Enum) > 0 && !validator.In(v, s.Enum...):
+		return "must be one of " + strings.Join(s.Enum, ", ")
+	case s.Format == "email" && !validator.Matches(v, validator.EmailRxp):
+		return "must be a valid email"
+	case s.Pattern != "" && !validator.Matches(v, compilePattern(s.Pattern)):
+		return fmt.Sprintf("must match %s", s.Pattern)
+	}
+	return ""
+}
+
+var patterns sync.Map
+
+func compilePattern(pattern string) *regexp.Regexp {
+	if rx, ok := patterns.Load(pattern); ok {
+		return rx.(*regexp.Regexp)
+	}
+	rx := regexp.MustCompile(pattern)
+	patterns.Store(pattern, rx)
+	return rx
+}
+
+func checkNumber(s *Schema, v float64) string {
+	switch {
+	case s.Type == "integer" && v != math.Trunc(v):
+		return "must be an integer"
+	case s.Minimum != nil && v < *s.Minimum:
+		return fmt.Sprintf("must be greater than or equal to %v", *s.Minimum)
+	case s.Maximum != nil && v > *s.Maximum:
+		return fmt.Sprintf("must be less than or equal to %v", *s.Maximum)
+	}
+	return ""
+}
+
+// typeIs reports whether s accepts one of types. A schema without a type
+// accepts anything.
+func typeIs(s *Schema, types ...string) bool {
+	if s.Type == "" {
+		return true
+	}
+	for _, t := range types {
+		if s.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(t string) string {
+	switch t {
+	case "integer", "array", "object":
+		return "an " + t
+	case "":
+		return "a valid value"
+	}
+	return "a " + t
+}
+
+func unique(values []interface{}) bool {
+	for i := range values {
+		for j := i + 1; j < len(values); j++ {
+			if reflect.DeepEqual(values[i], values[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func join(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
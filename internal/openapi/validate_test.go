@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testDocument holds a Movie schema covering the constraints Validate checks.
+const testDocument = `{
+	"components": {"schemas": {
+		"Movie": {
+			"type": "object",
+			"required": ["title", "genres"],
+			"properties": {
+				"title": {"type": "string", "minLength": 1, "maxLength": 10},
+				"year": {"type": "integer", "minimum": 1888, "maximum": 2100},
+				"rating": {"type": "number", "nullable": true},
+				"kind": {"type": "string", "enum": ["film", "series"]},
+				"contact": {"type": "string", "format": "email"},
+				"code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+				"draft": {"type": "boolean"},
+				"genres": {"type": "array", "minItems": 1, "maxItems": 3, "uniqueItems": true, "items": {"type": "string", "minLength": 2}},
+				"crew": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/Person"}}
+			}
+		},
+		"Person": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+	}}
+}`
+
+func TestValidate(t *testing.T) {
+	var d Document
+	if err := json.Unmarshal([]byte(testDocument), &d); err != nil {
+		t.Fatal(err)
+	}
+	movie := &Schema{Ref: "#/components/schemas/Movie"}
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]string
+	}{
+		{"valid", `{"title":"Moana","year":2016,"rating":null,"kind":"film","contact":"a@b.test","code":"ABC","draft":true,"genres":["animation"],"crew":{"director":{"name":"Ron"}}}`, map[string]string{}},
+		{"not an object", `[]`, map[string]string{"body": "must be an object"}},
+		{"null body", `null`, map[string]string{"body": "must not be null"}},
+		{"missing required", `{}`, map[string]string{"title": "must be provided", "genres": "must be provided"}},
+		{"empty string", `{"title":"","genres":["ab"]}`, map[string]string{"title": "must be provided"}},
+		{"long string", `{"title":"Moana Moana Moana","genres":["ab"]}`, map[string]string{"title": "must not be more than 10 bytes long"}},
+		{"wrong type", `{"title":1,"genres":["ab"]}`, map[string]string{"title": "must be a string"}},
+		{"not nullable", `{"title":null,"genres":["ab"]}`, map[string]string{"title": "must not be null"}},
+		{"not an integer", `{"title":"Moana","year":2016.5,"genres":["ab"]}`, map[string]string{"year": "must be an integer"}},
+		{"below minimum", `{"title":"Moana","year":1800,"genres":["ab"]}`, map[string]string{"year": "must be greater than or equal to 1888"}},
+		{"above maximum", `{"title":"Moana","year":3000,"genres":["ab"]}`, map[string]string{"year": "must be less than or equal to 2100"}},
+		{"enum", `{"title":"Moana","kind":"short","genres":["ab"]}`, map[string]string{"kind": "must be one of film, series"}},
+		{"email", `{"title":"Moana","contact":"nope","genres":["ab"]}`, map[string]string{"contact": "must be a valid email"}},
+		{"pattern", `{"title":"Moana","code":"abc","genres":["ab"]}`, map[string]string{"code": "must match ^[A-Z]{3}$"}},
+		{"boolean", `{"title":"Moana","draft":"yes","genres":["ab"]}`, map[string]string{"draft": "must be a boolean"}},
+		{"too few items", `{"title":"Moana","genres":[]}`, map[string]string{"genres": "must contain at least 1 items"}},
+		{"too many items", `{"title":"Moana","genres":["ab","cd","ef","gh"]}`, map[string]string{"genres": "must not contain more than 3 items"}},
+		{"duplicate items", `{"title":"Moana","genres":["ab","ab"]}`, map[string]string{"genres": "must not contain duplicate values"}},
+		{"invalid item", `{"title":"Moana","genres":["ab","c"]}`, map[string]string{"genres[1]": "must be at least 2 bytes long"}},
+		{"additional properties", `{"title":"Moana","genres":["ab"],"crew":{"director":{}}}`, map[string]string{"crew.director.name": "must be provided"}},
+		{"unknown properties are left to bind", `{"title":"Moana","genres":["ab"],"extra":1}`, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			errs := make(map[string]string)
+			d.Validate(movie, value, "", errs)
+			if !reflect.DeepEqual(errs, tt.want) {
+				t.Errorf("got %v, want %v", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateParameter(t *testing.T) {
+	var d Document
+	min, max := 1.0, 100.0
+	tests := []struct {
+		schema *Schema
+		raw    string
+		want   string
+	}{
+		{&Schema{Type: "integer", Minimum: &min, Maximum: &max}, "20", ""},
+		{&Schema{Type: "integer", Minimum: &min, Maximum: &max}, "0", "must be greater than or equal to 1"},
+		{&Schema{Type: "integer", Minimum: &min, Maximum: &max}, "101", "must be less than or equal to 100"},
+		{&Schema{Type: "integer"}, "1.5", "must be an integer"},
+		{&Schema{Type: "integer"}, "abc", "must be an integer"},
+		{&Schema{Type: "number"}, "NaN", "must be a number"},
+		{&Schema{Type: "number"}, "Inf", "must be a number"},
+		{&Schema{Type: "boolean"}, "true", ""},
+		{&Schema{Type: "boolean"}, "yes", "must be a boolean"},
+		{&Schema{Type: "string", Enum: []string{"id", "-id"}}, "-id", ""},
+		{&Schema{Type: "string", Enum: []string{"id", "-id"}}, "year", "must be one of id, -id"},
+	}
+	for _, tt := range tests {
+		if got := d.ValidateParameter(Parameter{Name: "p", Schema: tt.schema}, tt.raw); got != tt.want {
+			t.Errorf("%s %q: got %q, want %q", tt.schema.Type, tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to decoded JSON values.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTestFailed    = errors.New("test failed")
+	ErrPathNotFound  = errors.New("path does not exist")
+	ErrInvalidPath   = errors.New("path must be a JSON pointer")
+	ErrMissingValue  = errors.New("value must be provided")
+	ErrUnsupportedOp = errors.New("op must be add, remove, replace or test")
+)
+
+// Merge applies an RFC 7396 merge patch to target: members set to null are
+// removed and objects are merged recursively. Anything else replaces the
+// target value.
+func Merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = Merge(t[key], value)
+	}
+	return t
+}
+
+// Operation is a single RFC 6902 operation. The move and copy operations are
+// not supported.
+type Operation struct {
+	Op    string          `json:"op" validate:"required,enum=add|remove|replace|test"`
+	Path  string          `json:"path" validate:"required"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError reports the operation that made Apply fail.
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Apply applies ops to doc in order and returns the patched document. doc is
+// modified in place and must be discarded when Apply fails.
+func Apply(doc interface{}, ops []Operation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+func (op Operation) apply(doc interface{}) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, ErrMissingValue
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, ErrUnsupportedOp
+	}
+
+	if op.Op == "test" {
+		current, err := get(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	if len(tokens) == 0 {
+		if op.Op == "remove" {
+			return nil, ErrInvalidPath
+		}
+		return value, nil
+	}
+	return walk(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			_, exists := c[token]
+			switch {
+			case op.Op == "add":
+				c[token] = value
+			case !exists:
+				return nil, ErrPathNotFound
+			case op.Op == "replace":
+				c[token] = value
+			default:
+				delete(c, token)
+			}
+			return c, nil
+		case []interface{}:
+			if op.Op == "add" {
+				if token == "-" {
+					return append(c, value), nil
+				}
+				i, err := arrayIndex(token, len(c))
+				if err != nil {
+					return nil, err
+				}
+				c = append(c, nil)
+				copy(c[i+1:], c[i:])
+				c[i] = value
+				return c, nil
+			}
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			if op.Op == "replace" {
+				c[i] = value
+				return c, nil
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// walk calls fn with the container holding the value tokens points to, and
+// stores the container it returns back in its parent.
+func walk(node interface{}, tokens []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		child, err := walk(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := walk(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, ErrPathNotFound
+}
+
+func get(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPath
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || strings.Trim(token, "0123456789") != "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrPathNotFound
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
@@ -0,0 +1,120 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"replace member", `{"a":1,"b":2}`, `{"a":3}`, `{"a":3,"b":2}`},
+		{"null removes member", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"null for a missing member", `{"a":1}`, `{"c":null}`, `{"a":1}`},
+		{"nested null", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"object over scalar", `{"a":1}`, `{"a":{"b":null,"c":1}}`, `{"a":{"c":1}}`},
+		{"non-object patch", `{"a":1}`, `[1]`, `[1]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge(decode(t, tt.target), decode(t, tt.patch))
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+		err  error
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, nil},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `{"a":2}`, nil},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, nil},
+		{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", ErrPathNotFound},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"remove whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, "", ErrInvalidPath},
+
+		{"~1 unescapes to /", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`, nil},
+		{"~0 unescapes to ~", `{"a~b":1}`, `[{"op":"replace","path":"/a~0b","value":2}]`, `{"a~b":2}`, nil},
+		{"~01 unescapes to ~1", `{"a~1":1,"a/":2}`, `[{"op":"remove","path":"/a~01"}]`, `{"a/":2}`, nil},
+		{"pointer without a slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`, "", ErrInvalidPath},
+
+		{"append with -", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`, nil},
+		{"insert at index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2]}`, nil},
+		{"insert at length", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`, nil},
+		{"insert past length", `{"a":[1,2]}`, `[{"op":"add","path":"/a/3","value":3}]`, "", ErrPathNotFound},
+		{"replace last element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/1","value":3}]`, `{"a":[1,3]}`, nil},
+		{"replace at length", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/2","value":3}]`, "", ErrPathNotFound},
+		{"replace with -", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/-","value":3}]`, "", ErrPathNotFound},
+		{"remove element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, nil},
+		{"remove at length", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/2"}]`, "", ErrPathNotFound},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, "", ErrPathNotFound},
+		{"negative index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-1"}]`, "", ErrPathNotFound},
+		{"nested through an array", `{"a":[{"b":1}]}`, `[{"op":"replace","path":"/a/0/b","value":2}]`, `{"a":[{"b":2}]}`, nil},
+
+		{"test passes", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]},{"op":"remove","path":"/a"}]`, `{}`, nil},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`, "", ErrTestFailed},
+		{"test on a missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, "", ErrPathNotFound},
+
+		{"missing value", `{"a":1}`, `[{"op":"add","path":"/b"}]`, "", ErrMissingValue},
+		{"unsupported op", `{"a":1}`, `[{"op":"move","path":"/b"}]`, "", ErrUnsupportedOp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(decode(t, tt.doc), ops)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyReportsTheFailingOperation(t *testing.T) {
+	ops := []Operation{
+		{Op: "replace", Path: "/a", Value: json.RawMessage(`2`)},
+		{Op: "test", Path: "/a", Value: json.RawMessage(`1`)},
+	}
+	_, err := Apply(decode(t, `{"a":1}`), ops)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("got error %v, want an OperationError", err)
+	}
+	if opErr.Index != 1 || opErr.Op != "test" || opErr.Path != "/a" {
+		t.Errorf("got %+v, want the second operation", opErr)
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type window struct {
+	end   time.Time
+	count int
+}
+
+// MemoryLimiter keeps its counters in process memory, so every replica
+// enforces its own budget.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func NewMemory() *MemoryLimiter {
+	return &MemoryLimiter{
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, p Policy) (Result, error) {
+	now := time.Now()
+	key = p.Name + ":" + key
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, w := range l.windows {
+			if now.After(w.end) {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, found := l.windows[key]
+	if !found || !now.Before(w.end) {
+		w = &window{end: now.Truncate(p.Window).Add(p.Window)}
+		l.windows[key] = w
+	}
+	w.count++
+	return result(p, w.count, w.end), nil
+}
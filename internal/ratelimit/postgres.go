@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PostgresLimiter keeps its counters in the rate_limits table so that all
+// replicas share the same budget. Windows are aligned on the database clock
+// with millisecond precision.
+type PostgresLimiter struct {
+	DB *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *PostgresLimiter {
+	return &PostgresLimiter{DB: db}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, p Policy) (Result, error) {
+	if p.Window < time.Millisecond {
+		return Result{}, fmt.Errorf("rate limit policy %q: window %s is shorter than 1ms", p.Name, p.Window)
+	}
+	query := `
+		WITH w AS (
+			SELECT to_timestamp(floor(extract(epoch FROM NOW()) * 1000 / $2::float8) * $2::float8 / 1000) AS start
+		)
+		INSERT INTO rate_limits (key, window_start, count)
+		SELECT $1, w.start, 1 FROM w
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1 ELSE 1 END,
+			window_start = EXCLUDED.window_start
+		RETURNING count, window_start
+	`
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	var count int
+	var windowStart time.Time
+	err := l.DB.QueryRowContext(ctx, query, p.Name+":"+key, p.Window.Milliseconds()).Scan(&count, &windowStart)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(p, count, windowStart.Add(p.Window)), nil
+}
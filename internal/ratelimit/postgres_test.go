@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresLimiterPassesTheWindowInMilliseconds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	windowStart := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO rate_limits")).
+		WithArgs("default:1.2.3.4", int64(500)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "window_start"}).AddRow(3, windowStart))
+
+	p := Policy{Name: "default", Limit: 2, Window: 500 * time.Millisecond, KeyBy: KeyByIP}
+	res, err := NewPostgres(db).Allow(context.Background(), "1.2.3.4", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.Remaining != 0 || res.Limit != 2 {
+		t.Errorf("got %+v, want a rejection with nothing remaining", res)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresLimiterRejectsWindowsUnderOneMillisecond(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	p := Policy{Name: "default", Limit: 1, Window: 500 * time.Microsecond, KeyBy: KeyByIP}
+	if _, err := NewPostgres(db).Allow(context.Background(), "1.2.3.4", p); err == nil {
+		t.Fatal("Allow succeeded with a window that rounds to 0ms")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
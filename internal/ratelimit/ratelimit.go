@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	KeyByIP     = "ip"
+	KeyByUser   = "user"
+	KeyByAPIKey = "apikey"
+)
+
+// Policy allows Limit requests per Window for every key, where the key is
+// derived from the request according to KeyBy.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	KeyBy  string
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+// Limiter counts requests in fixed windows. Implementations must be safe for
+// concurrent use; the Postgres implementation also shares its counters
+// between replicas.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+func result(p Policy, count int, windowEnd time.Time) Result {
+	remaining := p.Limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{
+		Allowed:   count <= p.Limit,
+		Limit:     p.Limit,
+		Remaining: remaining,
+		Reset:     time.Until(windowEnd),
+	}
+}
+
+// Policies maps route groups to their policy. It reads and writes itself in
+// the ParsePolicies format, so it can be set from a config file, the
+// environment or a flag.
+type Policies map[string]Policy
+
+func (ps *Policies) UnmarshalText(text []byte) error {
+	policies, err := ParsePolicies(string(text))
+	if err != nil {
+		return err
+	}
+	*ps = policies
+	return nil
+}
+
+func (ps Policies) MarshalText() ([]byte, error) {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = ps[name].String()
+	}
+	return []byte(strings.Join(fields, " ")), nil
+}
+
+// ParsePolicies parses a space or comma separated list of policies written as
+// name=limit/window[:keyBy], for example "auth=5/1m:ip movies=120/1m:user".
+func ParsePolicies(s string) (Policies, error) {
+	policies := make(Policies)
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		p, err := parsePolicy(field)
+		if err != nil {
+			return nil, err
+		}
+		policies[p.Name] = p
+	}
+	return policies, nil
+}
+
+func parsePolicy(s string) (Policy, error) {
+	p := Policy{KeyBy: KeyByIP}
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return p, fmt.Errorf("invalid rate limit policy %q", s)
+	}
+	p.Name = parts[0]
+	spec := parts[1]
+	if i := strings.Index(spec, ":"); i >= 0 {
+		p.KeyBy = spec[i+1:]
+		spec = spec[:i]
+	}
+	switch p.KeyBy {
+	case KeyByIP, KeyByUser, KeyByAPIKey:
+	default:
+		return p, fmt.Errorf("invalid key %q in rate limit policy %q", p.KeyBy, s)
+	}
+	parts = strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return p, fmt.Errorf("invalid rate limit policy %q", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit <= 0 {
+		return p, fmt.Errorf("invalid limit in rate limit policy %q", s)
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window < time.Second {
+		return p, fmt.Errorf("invalid window in rate limit policy %q", s)
+	}
+	p.Limit = limit
+	p.Window = window
+	return p, nil
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%s=%d/%s:%s", p.Name, p.Limit, p.Window, p.KeyBy)
+}
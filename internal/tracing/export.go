@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// The types below follow the OTLP/JSON encoding of trace data, so the output
+// of every exporter can be fed to an OpenTelemetry collector as is.
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func attribute(a Attribute) otlpAttribute {
+	var v otlpValue
+	switch value := a.Value.(type) {
+	case string:
+		v.StringValue = &value
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &value
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: a.Key, Value: v}
+}
+
+func encode(service string, spans []*Span) ([]byte, error) {
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttribute{attribute(String("service.name", service))}
+	var ss otlpScopeSpans
+	ss.Scope.Name = service
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.status, Message: s.message},
+		}
+		if s.parent.IsValid() {
+			span.ParentSpanID = s.parent.String()
+		}
+		for _, a := range s.attributes {
+			span.Attributes = append(span.Attributes, attribute(a))
+		}
+		s.mu.Unlock()
+		ss.Spans = append(ss.Spans, span)
+	}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	return json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{rs}})
+}
+
+// WriterExporter writes each batch as one line of OTLP/JSON.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+func NewStdoutExporter() *WriterExporter {
+	return &WriterExporter{w: os.Stdout}
+}
+
+// NewFileExporter appends to the file at path, creating it and its directory
+// when they do not exist.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, c: f}, nil
+}
+
+func (e *WriterExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	b, err := encode(service, spans)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
+
+// OTLPHTTPExporter posts batches to an OTLP/HTTP endpoint such as
+// http://localhost:4318/v1/traces using the JSON encoding.
+type OTLPHTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewOTLPHTTPExporter(endpoint string) *OTLPHTTPExporter {
+	return &OTLPHTTPExporter{endpoint: endpoint, client: &http.Client{}}
+}
+
+func (e *OTLPHTTPExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	b, err := encode(service, spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("otlp exporter: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+func (e *OTLPHTTPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+)
+
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer batches ended spans in the background and hands them to an
+// exporter. Spans are dropped rather than blocking requests when the queue is
+// full.
+type Tracer struct {
+	service  string
+	exporter Exporter
+	queue    chan *Span
+	done     chan struct{}
+	onError  func(error)
+	mu       sync.RWMutex
+	closed   bool
+}
+
+func NewTracer(service string, exporter Exporter, onError func(error)) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		queue:    make(chan *Span, queueSize),
+		done:     make(chan struct{}),
+		onError:  onError,
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- s:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.exporter.Export(ctx, t.service, batch); err != nil && t.onError != nil {
+			t.onError(err)
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown flushes the queued spans and closes the exporter. Spans ended
+// after Shutdown are discarded.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	setGlobal(nil, t)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer *Tracer
+)
+
+// SetGlobal installs t as the tracer used by Start.
+func SetGlobal(t *Tracer) {
+	globalMu.Lock()
+	globalTracer = t
+	globalMu.Unlock()
+}
+
+func setGlobal(t, old *Tracer) {
+	globalMu.Lock()
+	if globalTracer == old {
+		globalTracer = t
+	}
+	globalMu.Unlock()
+}
+
+func global() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalTracer
+}
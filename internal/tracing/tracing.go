@@ -0,0 +1,218 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	Remote  bool
+}
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+func Int(key string, value int) Attribute { return Attribute{key, int64(value)} }
+
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// Span is a single timed operation. A nil *Span is valid and does nothing, so
+// callers never need to check whether tracing is enabled.
+type Span struct {
+	tracer     *Tracer
+	sc         SpanContext
+	parent     SpanID
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	mu         sync.Mutex
+	attributes []Attribute
+	status     int
+	message    string
+	ended      bool
+}
+
+// SetName renames the span, for names only known once it has started.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attrs...)
+	s.mu.Unlock()
+}
+
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = StatusError
+	s.message = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// TraceIDFromContext returns the hex trace ID of the span in ctx, or an empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc.TraceID.String()
+	}
+	return ""
+}
+
+func SpanIDFromContext(ctx context.Context) string {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc.SpanID.String()
+	}
+	return ""
+}
+
+// Start begins a span of KindInternal as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+func StartKind(ctx context.Context, name string, kind int, attrs ...Attribute) (context.Context, *Span) {
+	t := global()
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: attrs,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.sc.TraceID = parent.sc.TraceID
+		s.sc.Sampled = parent.sc.Sampled
+		s.parent = parent.sc.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		s.sc.TraceID = remote.TraceID
+		s.sc.Sampled = remote.Sampled
+		s.parent = remote.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract reads a W3C traceparent header and returns a context whose next
+// span continues the caller's trace. The spans of a trace the caller did not
+// sample are not exported either.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceparent(header.Get("traceparent"))
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent %q", v)
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent version %q", parts[0])
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent trace id: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent parent id: %w", err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid traceparent flags: %w", err)
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent %q", v)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, nil
+}
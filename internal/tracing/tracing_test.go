@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparentRoundTrips(t *testing.T) {
+	for _, v := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+	} {
+		sc, err := ParseTraceparent(v)
+		if err != nil {
+			t.Fatalf("ParseTraceparent(%q): %v", v, err)
+		}
+		if !sc.Remote {
+			t.Errorf("%s: span context is not remote", v)
+		}
+		if got := sc.Traceparent(); got != v {
+			t.Errorf("ParseTraceparent(%q).Traceparent() = %q", v, got)
+		}
+	}
+}
+
+func TestParseTraceparentRejectsMalformedValues(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		if _, err := ParseTraceparent(v); err == nil {
+			t.Errorf("ParseTraceparent(%q) succeeded", v)
+		}
+	}
+}
+
+func TestSpansFollowTheCallersSamplingDecision(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("test", &WriterExporter{w: &buf}, nil)
+	SetGlobal(tracer)
+
+	traces := map[string]bool{
+		"4bf92f3577b34da6a3ce929d0e0e4736": true,
+		"5ce03f4688c45eb7b4df03ae1f1f5847": false,
+	}
+	for traceID, sampled := range traces {
+		flags := "00"
+		if sampled {
+			flags = "01"
+		}
+		header := http.Header{"Traceparent": []string{"00-" + traceID + "-00f067aa0ba902b7-" + flags}}
+		ctx, server := StartKind(Extract(context.Background(), header), "server", KindServer)
+		_, child := Start(ctx, "child")
+		child.End()
+		server.End()
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for traceID, sampled := range traces {
+		want := 0
+		if sampled {
+			want = 2
+		}
+		if got := strings.Count(buf.String(), traceID); got != want {
+			t.Errorf("trace %s exported %d spans, want %d", traceID, got, want)
+		}
+	}
+}
+
+func TestNewFileExporterCreatesTheDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tmp", "traces.jsonl")
+	e, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Shutdown(context.Background())
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1 +1 @@
-DROP IF EXISTS users;
\ No newline at end of file
+DROP TABLE IF EXISTS users;
@@ -1,2 +1,2 @@
-DROP IF EXISTS users_permissions;
-DROP IF EXISTS permissions;
\ No newline at end of file
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    topic text NOT NULL,
+    payload jsonb NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    available_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    processed_at timestamp(0) with time zone,
+    last_error text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (available_at) WHERE processed_at IS NULL;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    template text NOT NULL,
+    locale text NOT NULL,
+    recipient citext NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    provider_message_id text NOT NULL DEFAULT '',
+    last_error text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS emails_recipient_idx ON emails (recipient);
+CREATE INDEX IF NOT EXISTS emails_provider_message_id_idx ON emails (provider_message_id);
+
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email citext PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    reason text NOT NULL
+);
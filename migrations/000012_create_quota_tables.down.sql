@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_usage;
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+DROP TABLE IF EXISTS quota_tiers;
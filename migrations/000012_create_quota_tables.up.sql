@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS quota_tiers (
+    name text PRIMARY KEY,
+    requests_per_minute integer NOT NULL CHECK (requests_per_minute > 0),
+    daily_limit integer NOT NULL CHECK (daily_limit >= 0)
+);
+
+INSERT INTO quota_tiers (name, requests_per_minute, daily_limit)
+VALUES ('free', 60, 1000), ('partner', 600, 100000), ('internal', 6000, 0)
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier text NOT NULL DEFAULT 'free' REFERENCES quota_tiers (name);
+
+CREATE TABLE IF NOT EXISTS user_usage (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    day date NOT NULL,
+    requests bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS client_certificates (
+    subject text PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1 @@
+-- The scrubbed template data cannot be restored.
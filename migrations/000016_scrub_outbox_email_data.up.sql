@@ -0,0 +1,3 @@
+UPDATE outbox
+SET payload = payload - 'data'
+WHERE topic = 'email' AND (processed_at IS NOT NULL OR attempts >= 5);
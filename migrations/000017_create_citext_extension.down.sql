@@ -0,0 +1 @@
+-- users.email depends on citext, the extension is left in place.
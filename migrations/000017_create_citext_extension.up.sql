@@ -0,0 +1,3 @@
+-- citext is created by setup.sql before any pending migration runs. This
+-- migration only records the dependency in the schema history.
+CREATE EXTENSION IF NOT EXISTS citext;
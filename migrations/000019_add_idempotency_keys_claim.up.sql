@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS claim text NOT NULL DEFAULT '';
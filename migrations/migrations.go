@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations so that the binary can apply
+// them without access to the source tree.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,4 @@
+-- Run before any pending migration. Statements must be safe to run again.
+
+-- users.email, created by 000004, is citext.
+CREATE EXTENSION IF NOT EXISTS citext;